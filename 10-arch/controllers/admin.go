@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"encoding/json"
+	"go-web/10-arch/logger"
+	"go-web/10-arch/middlewares"
+	"go-web/10-arch/settings"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap/zapcore"
+)
+
+// AdminConfigHandler 返回当前生效的配置，每个配置项都标注了来源（default/file/env/flag/runtime）
+// 默认返回 JSON，?format=yaml 或者 Accept: application/x-yaml 时返回 YAML
+func AdminConfigHandler(c *gin.Context) {
+	data := gin.H{
+		"files":  settings.ConfigFiles(),
+		"config": settings.Effective(),
+	}
+	render(c, http.StatusOK, data)
+}
+
+// AdminOverridesHandler 返回当前在运行时修改过的配置
+func AdminOverridesHandler(c *gin.Context) {
+	render(c, http.StatusOK, gin.H{"overrides": settings.Overrides()})
+}
+
+// AdminSetOverridesHandler 在运行时修改配置
+// 请求体为 {"log.level": "debug", "mysql.max_open_conns": 20}，值为 null 表示撤销之前的修改
+func AdminSetOverridesHandler(c *gin.Context) {
+	var changes map[string]interface{}
+	dec := json.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid request body", "error": err.Error()})
+		return
+	}
+	for k, v := range changes {
+		if n, ok := v.(json.Number); ok {
+			changes[k] = number(n)
+		}
+	}
+
+	if err := settings.SetOverrides(changes, c.ClientIP()); err != nil {
+		if ve, ok := err.(settings.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid overrides", "errors": ve})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid overrides", "error": err.Error()})
+		return
+	}
+	render(c, http.StatusOK, gin.H{"overrides": settings.Overrides()})
+}
+
+// AdminLogLevelHandler 返回当前的日志级别
+func AdminLogLevelHandler(c *gin.Context) {
+	render(c, http.StatusOK, logger.Status())
+}
+
+// AdminSetLogLevelHandler 临时修改日志级别
+// 请求体为 {"level": "debug", "ttl": "10m"}，ttl 可以省略，省略时一直生效到 log.level 配置发生变化或者重启
+func AdminSetLogLevelHandler(c *gin.Context) {
+	var req struct {
+		Level string `json:"level" binding:"required"`
+		TTL   string `json:"ttl"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid request body", "error": err.Error()})
+		return
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(req.Level)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid level", "error": err.Error()})
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid ttl", "ttl": req.TTL})
+			return
+		}
+	}
+	render(c, http.StatusOK, logger.SetLevel(l, ttl, c.ClientIP()))
+}
+
+// AdminLogStatsHandler 返回异步写日志的队列长度和丢弃的日志条数，以及丢弃的日志切割事件数
+func AdminLogStatsHandler(c *gin.Context) {
+	render(c, http.StatusOK, gin.H{"async": logger.Stats(), "rotate": logger.RotationStats()})
+}
+
+// AdminLogsHandler 返回内存中最近的日志
+// 支持 ?level=warn 最低级别、?request_id= 请求 ID、?q= 消息中包含的字符串、?limit= 最多返回多少条（默认 100）
+func AdminLogsHandler(c *gin.Context) {
+	q, err := logQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid query", "error": err.Error()})
+		return
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	render(c, http.StatusOK, gin.H{"logs": logger.Recent(q)})
+}
+
+// streamsDone 关闭之后所有的实时日志连接都会断开
+var (
+	streamsDone = make(chan struct{})
+	closeOnce   sync.Once
+)
+
+// CloseStreams 断开所有的实时日志连接
+// http.Server.Shutdown 不会取消正在处理的请求，不断开的话 Shutdown 要一直等到超时，通过 srv.RegisterOnShutdown 注册
+func CloseStreams() {
+	closeOnce.Do(func() { close(streamsDone) })
+}
+
+// AdminLogsTailHandler 用 Server-Sent Events 实时推送新的日志，过滤条件和 AdminLogsHandler 相同
+// 浏览器的 EventSource 不能设置请求头，可以用 ?token= 传管理接口的 token
+func AdminLogsTailHandler(c *gin.Context) {
+	q, err := logQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid query", "error": err.Error()})
+		return
+	}
+	ch, cancel := logger.Tail(q)
+	defer cancel()
+
+	// 定时发送心跳，避免连接被代理因为空闲断开
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-ch:
+			c.SSEvent("log", e)
+			return true
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-streamsDone:
+			return false
+		}
+	})
+}
+
+// AdminSlowHandler 返回最近的慢请求，按耗时从高到低排序，?limit= 限制返回的个数
+func AdminSlowHandler(c *gin.Context) {
+	reqs := middlewares.SlowRequests()
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid limit", "error": err.Error()})
+			return
+		}
+		if n >= 0 && n < len(reqs) {
+			reqs = reqs[:n]
+		}
+	}
+	render(c, http.StatusOK, gin.H{"requests": reqs})
+}
+
+// logQuery 解析查询日志的条件
+func logQuery(c *gin.Context) (logger.Query, error) {
+	q := logger.Query{
+		Level:     zapcore.DebugLevel,
+		RequestID: c.Query("request_id"),
+		Contains:  c.Query("q"),
+	}
+	if s := c.Query("level"); s != "" {
+		if err := q.Level.UnmarshalText([]byte(s)); err != nil {
+			return q, err
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// number 整数保持为整数，避免 20 变成 20.0 或者 20.5 被悄悄截断成 20
+func number(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// render 按 ?format= 或者 Accept 请求头返回 JSON 或 YAML
+func render(c *gin.Context, code int, data interface{}) {
+	format := c.Query("format")
+	if format == "" && c.NegotiateFormat(binding.MIMEJSON, binding.MIMEYAML) == binding.MIMEYAML {
+		format = "yaml"
+	}
+	if format == "yaml" {
+		c.YAML(code, data)
+		return
+	}
+	c.JSON(code, data)
+}
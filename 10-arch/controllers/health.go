@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"go-web/10-arch/logic"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler 健康检查，依赖的组件不可用时返回 503
+func HealthHandler(c *gin.Context) {
+	status, ok := logic.Health(c.Request.Context())
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status})
+}
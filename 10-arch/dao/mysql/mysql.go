@@ -1,13 +1,18 @@
 package mysql
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
-	"github.com/spf13/viper"
+	"go-web/10-arch/logger"
+	"go-web/10-arch/pkg/timing"
 	"go-web/10-arch/settings"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	driver "github.com/go-sql-driver/mysql"
 )
 
 var db *sqlx.DB
@@ -15,23 +20,63 @@ var db *sqlx.DB
 func Init(cfg *settings.MySQLConfig) (err error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True",
 		cfg.User,
-		cfg.Password,
+		cfg.Password.Value(),
 		cfg.Host,
 		cfg.Port,
 		cfg.Dbname,
 	)
 
+	// 驱动只在连接出错（例如连接被服务端断开）的时候打日志，记录为 mysql 的 error 日志
+	_ = driver.SetLogger(logger.NewWriter("mysql", zapcore.ErrorLevel))
+
 	// 如果用MustConnect, 那么连接不成功直接就panic了,不带Must那么就会返回一个错误，然后自己处理
-	db, err := sqlx.Connect("mysql", dsn)
+	db, err = sqlx.Connect("mysql", dsn)
 	if err != nil {
 		zap.L().Error("connect DB failed", zap.Error(err))
 		return err
 	}
-	db.SetMaxOpenConns(viper.GetInt("mysql.max_open_conns"))
-	db.SetMaxIdleConns(viper.GetInt("mysql.max_idle_conns"))
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+	// 配置热加载之后调整连接池的大小
+	settings.Subscribe(settings.SectionMySQL, onConfigChange)
+	return nil
+}
+
+// onConfigChange 连接池的大小可以直接调整，连接地址和账号发生变化需要重启服务才能生效
+func onConfigChange(old, new *settings.AppConfig) error {
+	o, n := old.MySQLConfig, new.MySQLConfig
+	if o.MaxOpenConns != n.MaxOpenConns || o.MaxIdleConns != n.MaxIdleConns {
+		db.SetMaxOpenConns(n.MaxOpenConns)
+		db.SetMaxIdleConns(n.MaxIdleConns)
+		zap.L().Info("mysql pool resized",
+			zap.Int("max_open_conns", n.MaxOpenConns),
+			zap.Int("max_idle_conns", n.MaxIdleConns))
+	}
+	if o.Host != n.Host || o.Port != n.Port || o.User != n.User || o.Password != n.Password || o.Dbname != n.Dbname {
+		zap.L().Warn("mysql connection settings changed, restart the server to apply them")
+	}
+	return nil
+}
+
+// Ping 检查数据库连接是否可用
+func Ping(ctx context.Context) error {
+	start := time.Now()
+	err := errors.New("mysql is not initialized")
+	if db != nil {
+		err = db.PingContext(ctx)
+		timing.AddDB(ctx, time.Since(start))
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("ping mysql failed", zap.Error(err))
+		return err
+	}
+	logger.FromContext(ctx).Debug("ping mysql", zap.Duration("cost", time.Since(start)))
 	return nil
 }
 
 func Close() {
-	_ = db.Close()
+	if db != nil {
+		_ = db.Close()
+	}
 }
@@ -0,0 +1,278 @@
+package logger
+
+import (
+	"go-web/10-arch/settings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 异步写日志时队列满了的处理方式
+const (
+	policyBlock          = "block"            // 等待队列空出位置
+	policyDropNewest     = "drop-newest"      // 丢弃新的日志
+	policyDropDebugFirst = "drop-debug-first" // 先丢弃队列中的 debug 日志，再丢弃新的 info、warn 日志，error 及以上等待
+)
+
+// 异步写日志时丢弃的日志条数，重新初始化 logger 之后不清零
+var (
+	droppedNewest uint64
+	droppedDebug  uint64
+)
+
+// AsyncStats 异步写日志的统计
+type AsyncStats struct {
+	Queued        int    `json:"queued" yaml:"queued"`                 // 当前队列中等待写入的日志条数
+	DroppedNewest uint64 `json:"dropped_newest" yaml:"dropped_newest"` // 队列满了之后丢弃的新日志条数
+	DroppedDebug  uint64 `json:"dropped_debug" yaml:"dropped_debug"`   // 为了给更重要的日志腾出位置丢弃的 debug 日志条数
+}
+
+// Stats 返回异步写日志的统计，没有开启异步时 Queued 始终为 0
+func Stats() AsyncStats {
+	s := AsyncStats{
+		DroppedNewest: atomic.LoadUint64(&droppedNewest),
+		DroppedDebug:  atomic.LoadUint64(&droppedDebug),
+	}
+	mu.Lock()
+	ws := writers
+	mu.Unlock()
+	for _, w := range ws {
+		if a, ok := w.(*asyncWriter); ok {
+			a.mu.Lock()
+			s.Queued += len(a.queue)
+			a.mu.Unlock()
+		}
+	}
+	return s
+}
+
+type asyncEntry struct {
+	level zapcore.Level
+	p     []byte
+}
+
+// batchSize 攒够这么多字节的日志之后写一次 out
+const batchSize = 64 * 1024
+
+// asyncWriter 把日志放到有界队列中，由后台的 goroutine 批量写到 out
+// 每次写到 out 的都是完整的若干条日志，按大小切割时一条日志不会被拆到两个文件中，
+// 多个输出写同一个文件时也不会互相穿插半条日志
+// 按 flush_interval 定时写出攒着的日志，Sync 时把队列中的日志全部写完再返回
+type asyncWriter struct {
+	out     zapcore.WriteSyncer
+	pending []byte // 还没写到 out 的完整日志，只在后台的 goroutine 中使用
+	policy  string
+	size    int
+	mu      sync.Mutex
+	notFull *sync.Cond
+	queue   []asyncEntry
+	closed  bool
+
+	wake   chan struct{}
+	syncCh chan chan error
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newAsyncWriter(out zapcore.WriteSyncer, cfg settings.AsyncConfig) *asyncWriter {
+	w := &asyncWriter{
+		out:     out,
+		pending: make([]byte, 0, batchSize),
+		policy:  cfg.Policy,
+		size:    cfg.QueueSize,
+		wake:    make(chan struct{}, 1),
+		syncCh:  make(chan chan error),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+	go w.run(cfg.FlushInterval)
+	return w
+}
+
+// enqueue 把一条日志放到队列中，p 会被复制
+func (w *asyncWriter) enqueue(level zapcore.Level, p []byte) error {
+	w.mu.Lock()
+	for !w.closed && len(w.queue) >= w.size {
+		if w.policy == policyDropDebugFirst && w.evictDebug() {
+			break
+		}
+		if w.policy == policyDropNewest || (w.policy == policyDropDebugFirst && level < zapcore.ErrorLevel) {
+			w.mu.Unlock()
+			atomic.AddUint64(&droppedNewest, 1)
+			return nil
+		}
+		w.notFull.Wait()
+	}
+	if w.closed {
+		// 已经关闭了，直接写到 out，避免丢日志
+		w.mu.Unlock()
+		_, err := w.out.Write(p)
+		return err
+	}
+	w.queue = append(w.queue, asyncEntry{level: level, p: append([]byte(nil), p...)})
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// evictDebug 丢弃队列中最早的一条 debug 日志，调用方需要持有 w.mu
+func (w *asyncWriter) evictDebug() bool {
+	for i, e := range w.queue {
+		if e.level <= zapcore.DebugLevel {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			atomic.AddUint64(&droppedDebug, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// Write 不经过 asyncCore 写入时没有级别信息，按 info 处理
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	if err := w.enqueue(zapcore.InfoLevel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync 等待队列中的日志全部写完并刷新到 out
+func (w *asyncWriter) Sync() error {
+	ch := make(chan error, 1)
+	select {
+	case w.syncCh <- ch:
+		return <-ch
+	case <-w.done:
+		return w.out.Sync()
+	}
+}
+
+// Close 写完队列中的日志之后停止后台的 goroutine，之后的日志直接写到 out，不关闭 out
+func (w *asyncWriter) Close() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return nil
+}
+
+func (w *asyncWriter) run(interval time.Duration) {
+	defer close(w.done)
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.wake:
+			w.drain()
+		case <-ticker.C:
+			w.drain()
+			_ = w.flush()
+		case ch := <-w.syncCh:
+			w.drain()
+			err := w.flush()
+			if e := w.out.Sync(); err == nil {
+				err = e
+			}
+			ch <- err
+		case <-w.stop:
+			w.mu.Lock()
+			w.closed = true
+			w.notFull.Broadcast()
+			w.mu.Unlock()
+			w.drain()
+			_ = w.flush()
+			_ = w.out.Sync()
+			return
+		}
+	}
+}
+
+// drain 把队列中的日志放到 pending 中，攒够 batchSize 就写到 out
+func (w *asyncWriter) drain() {
+	for {
+		w.mu.Lock()
+		batch := w.queue
+		w.queue = nil
+		w.notFull.Broadcast()
+		w.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		for _, e := range batch {
+			if len(w.pending)+len(e.p) > batchSize {
+				_ = w.flush()
+			}
+			if len(e.p) >= batchSize {
+				// 很大的一条日志单独写
+				_, _ = w.out.Write(e.p)
+				continue
+			}
+			w.pending = append(w.pending, e.p...)
+		}
+	}
+}
+
+// flush 把 pending 中的日志一次写到 out
+func (w *asyncWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := w.out.Write(w.pending)
+	w.pending = w.pending[:0]
+	return err
+}
+
+// asyncCore 和 zapcore.NewCore 创建的 core 一样，只是写入时带上日志级别，供 drop-debug-first 使用
+type asyncCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out *asyncWriter
+}
+
+func newAsyncCore(enc zapcore.Encoder, out *asyncWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return &asyncCore{LevelEnabler: enab, enc: enc, out: out}
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &asyncCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), out: c.out}
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	err = c.out.enqueue(ent.Level, buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+	// 和 zapcore 一样，panic、fatal 的日志写完之后马上刷新，进程可能马上就退出了
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *asyncCore) Sync() error {
+	return c.out.Sync()
+}
@@ -0,0 +1,176 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"go-web/10-arch/settings"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// recorder 记录每一次 Write，设置了 gate 时每次 Write 都要等 gate 关闭才返回
+type recorder struct {
+	mu      sync.Mutex
+	writes  [][]byte
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+func newRecorder(blocking bool) *recorder {
+	r := &recorder{entered: make(chan struct{}, 100)}
+	if blocking {
+		r.gate = make(chan struct{})
+	}
+	return r
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.entered <- struct{}{}
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	r.writes = append(r.writes, append([]byte(nil), p...))
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+func (r *recorder) Sync() error { return nil }
+
+func (r *recorder) data() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return string(bytes.Join(r.writes, nil))
+}
+
+func asyncConfig(size int, policy string) settings.AsyncConfig {
+	return settings.AsyncConfig{Enabled: true, QueueSize: size, Policy: policy, FlushInterval: time.Hour}
+}
+
+// line 返回一条以 \n 结尾、总长度为 n 的日志
+func line(tag string, n int) []byte {
+	return []byte(tag + strings.Repeat("x", n-len(tag)-1) + "\n")
+}
+
+func TestAsyncWritesWholeEntries(t *testing.T) {
+	out := newRecorder(false)
+	w := newAsyncWriter(out, asyncConfig(10000, policyBlock))
+	var want bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		// 长度不同的日志，保证批量写的边界不会刚好对齐
+		p := line(fmt.Sprintf("entry-%d ", i), 20+i%997)
+		want.Write(p)
+		if err := w.enqueue(zapcore.InfoLevel, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	big := line("big ", batchSize+10)
+	want.Write(big)
+	_ = w.enqueue(zapcore.InfoLevel, big)
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if got := out.data(); got != want.String() {
+		t.Fatalf("written data differs: got %d bytes, want %d", len(got), want.Len())
+	}
+	for i, p := range out.writes {
+		if len(p) == 0 || p[len(p)-1] != '\n' {
+			t.Fatalf("write %d does not end on an entry boundary", i)
+		}
+		if len(p) > batchSize && bytes.Count(p, []byte("\n")) > 1 {
+			t.Fatalf("write %d of %d bytes batches entries past batchSize", i, len(p))
+		}
+	}
+}
+
+// blockWorker 写一条很大的日志，等后台的 goroutine 卡在 out.Write 中
+func blockWorker(t *testing.T, w *asyncWriter, out *recorder) {
+	t.Helper()
+	_ = w.enqueue(zapcore.InfoLevel, line("first ", batchSize))
+	select {
+	case <-out.entered:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not start writing")
+	}
+}
+
+func TestAsyncDropNewest(t *testing.T) {
+	out := newRecorder(true)
+	w := newAsyncWriter(out, asyncConfig(1, policyDropNewest))
+	blockWorker(t, w, out)
+
+	before := atomic.LoadUint64(&droppedNewest)
+	_ = w.enqueue(zapcore.ErrorLevel, []byte("kept\n"))
+	_ = w.enqueue(zapcore.ErrorLevel, []byte("dropped\n"))
+	if n := atomic.LoadUint64(&droppedNewest) - before; n != 1 {
+		t.Fatalf("dropped %d entries, want 1", n)
+	}
+	close(out.gate)
+	_ = w.Close()
+	if got := out.data(); !strings.Contains(got, "kept\n") || strings.Contains(got, "dropped") {
+		t.Fatalf("unexpected output: %q", got[len(got)-20:])
+	}
+}
+
+func TestAsyncDropDebugFirst(t *testing.T) {
+	out := newRecorder(true)
+	w := newAsyncWriter(out, asyncConfig(2, policyDropDebugFirst))
+	blockWorker(t, w, out)
+
+	debug0 := atomic.LoadUint64(&droppedDebug)
+	newest0 := atomic.LoadUint64(&droppedNewest)
+	_ = w.enqueue(zapcore.DebugLevel, []byte("debug\n"))
+	_ = w.enqueue(zapcore.InfoLevel, []byte("info\n"))
+	// 队列满了，error 把 debug 挤掉
+	_ = w.enqueue(zapcore.ErrorLevel, []byte("error\n"))
+	// 队列中没有 debug 了，新的 info 被丢弃
+	_ = w.enqueue(zapcore.InfoLevel, []byte("late-info\n"))
+
+	if n := atomic.LoadUint64(&droppedDebug) - debug0; n != 1 {
+		t.Errorf("droppedDebug = %d, want 1", n)
+	}
+	if n := atomic.LoadUint64(&droppedNewest) - newest0; n != 1 {
+		t.Errorf("droppedNewest = %d, want 1", n)
+	}
+	close(out.gate)
+	_ = w.Close()
+	got := out.data()
+	if !strings.HasSuffix(got, "info\nerror\n") || strings.Contains(got, "debug") || strings.Contains(got, "late-info") {
+		t.Fatalf("unexpected output: %q", got[len(got)-30:])
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	out := newRecorder(true)
+	w := newAsyncWriter(out, asyncConfig(1, policyBlock))
+	blockWorker(t, w, out)
+	_ = w.enqueue(zapcore.InfoLevel, []byte("queued\n"))
+
+	done := make(chan struct{})
+	go func() {
+		_ = w.enqueue(zapcore.InfoLevel, []byte("waiting\n"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("enqueue returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(out.gate)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue still blocked after the queue drained")
+	}
+	_ = w.Close()
+	if got := out.data(); !strings.HasSuffix(got, "queued\nwaiting\n") {
+		t.Fatalf("unexpected output: %q", got[len(got)-20:])
+	}
+}
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ginKey 请求的 logger 在 gin.Context 中的 key
+const ginKey = "logger"
+
+// ctxKey 请求的 logger 在 context.Context 中的 key
+type ctxKey struct{}
+
+// NewContext 把 logger 保存到 ctx 中
+func NewContext(ctx context.Context, lg *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, lg)
+}
+
+// WithGin 把 logger 同时保存到 gin.Context 和请求的 context.Context 中
+// 之后不管是拿到 *gin.Context 还是 c.Request.Context()，都可以通过 FromContext 取出来
+func WithGin(c *gin.Context, lg *zap.Logger) {
+	c.Set(ginKey, lg)
+	c.Request = c.Request.WithContext(NewContext(c.Request.Context(), lg))
+}
+
+// FromContext 返回 ctx 中保存的 logger，没有的话返回全局的 logger
+// ctx 可以是 *gin.Context，也可以是从它传下去的 context.Context
+func FromContext(ctx context.Context) *zap.Logger {
+	if ctx == nil {
+		return zap.L()
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		if lg, ok := c.Get(ginKey); ok {
+			return lg.(*zap.Logger)
+		}
+		return zap.L()
+	}
+	if lg, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return lg
+	}
+	return zap.L()
+}
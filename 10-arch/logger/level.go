@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// level 所有 core 共用的日志级别，修改之后立即生效，不需要重新创建 logger
+var level = zap.NewAtomicLevel()
+
+// levelState 配置中的日志级别，以及通过管理接口临时修改的级别
+var levelState struct {
+	sync.Mutex
+	configured zapcore.Level
+	overridden bool
+	expires    time.Time // 临时修改的级别到期的时间，零值表示不会自动恢复
+	gen        int       // 每次修改加 1，用来忽略已经过期的定时器
+}
+
+// LevelStatus 当前的日志级别
+type LevelStatus struct {
+	Level      string     `json:"level" yaml:"level"`
+	Configured string     `json:"configured" yaml:"configured"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+// Level 返回当前的日志级别
+func Level() zapcore.Level {
+	return level.Level()
+}
+
+// Status 返回当前的日志级别以及临时修改的过期时间
+func Status() LevelStatus {
+	levelState.Lock()
+	defer levelState.Unlock()
+	return status()
+}
+
+func status() LevelStatus {
+	s := LevelStatus{Level: level.Level().String(), Configured: levelState.configured.String()}
+	if levelState.overridden && !levelState.expires.IsZero() {
+		t := levelState.expires
+		s.ExpiresAt = &t
+	}
+	return s
+}
+
+// SetLevel 临时修改日志级别，ttl 大于 0 时到期之后自动恢复成配置中的级别
+// 配置文件中的 log.level 发生变化时，临时修改的级别会被配置覆盖
+func SetLevel(l zapcore.Level, ttl time.Duration, actor string) LevelStatus {
+	levelState.Lock()
+	defer levelState.Unlock()
+
+	old := level.Level()
+	levelState.gen++
+	levelState.overridden = true
+	levelState.expires = time.Time{}
+	if ttl > 0 {
+		levelState.expires = time.Now().Add(ttl)
+		gen := levelState.gen
+		time.AfterFunc(ttl, func() { revert(gen) })
+	}
+	change(l, func() {
+		zap.L().Named("audit").Warn("log level changed",
+			zap.Stringer("old", old),
+			zap.Stringer("new", l),
+			zap.Duration("ttl", ttl),
+			zap.String("actor", actor),
+		)
+	})
+	return status()
+}
+
+// change 修改日志级别，在新旧两个级别中较低的那个生效时调用 audit 写审计日志
+// 这样把级别调高到 error 的时候审计日志也能记录下来
+func change(l zapcore.Level, audit func()) {
+	if l > level.Level() {
+		audit()
+		level.SetLevel(l)
+		return
+	}
+	level.SetLevel(l)
+	audit()
+}
+
+// revert 临时修改的级别到期，恢复成配置中的级别
+func revert(gen int) {
+	levelState.Lock()
+	defer levelState.Unlock()
+	if gen != levelState.gen {
+		return
+	}
+	old := level.Level()
+	levelState.gen++
+	levelState.overridden = false
+	levelState.expires = time.Time{}
+	change(levelState.configured, func() {
+		zap.L().Named("audit").Warn("log level reverted",
+			zap.Stringer("old", old),
+			zap.Stringer("new", levelState.configured),
+		)
+	})
+}
+
+// setConfigured 配置中的日志级别发生变化时调用
+// 配置没有变化时保留临时修改的级别，变化了则以配置为准
+func setConfigured(l zapcore.Level) {
+	levelState.Lock()
+	defer levelState.Unlock()
+	if levelState.overridden && l == levelState.configured {
+		return
+	}
+	levelState.gen++
+	levelState.configured = l
+	levelState.overridden = false
+	levelState.expires = time.Time{}
+	level.SetLevel(l)
+}
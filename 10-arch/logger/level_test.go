@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// resetLevel 清掉临时修改的级别，配置中的级别设置为 l
+func resetLevel(l zapcore.Level) {
+	levelState.Lock()
+	levelState.overridden = false
+	levelState.Unlock()
+	setConfigured(l)
+}
+
+func TestSetLevelRevertsAfterTTL(t *testing.T) {
+	resetLevel(zapcore.InfoLevel)
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	s := SetLevel(zapcore.DebugLevel, 50*time.Millisecond, "tester")
+	if s.Level != "debug" || s.Configured != "info" || s.ExpiresAt == nil {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	waitFor(t, "the level to revert", func() bool { return Level() == zapcore.InfoLevel })
+	if s := Status(); s.ExpiresAt != nil {
+		t.Errorf("expires_at = %v after revert", s.ExpiresAt)
+	}
+	if n := logs.FilterMessage("log level reverted").Len(); n != 1 {
+		t.Errorf("%d revert audit entries, want 1", n)
+	}
+}
+
+func TestSetLevelCancelsPendingRevert(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration // 第二次修改的 ttl
+	}{
+		{"without ttl", 0},
+		{"longer ttl", time.Hour},
+	}
+	for _, tt := range tests {
+		resetLevel(zapcore.InfoLevel)
+		SetLevel(zapcore.DebugLevel, 30*time.Millisecond, "tester")
+		s := SetLevel(zapcore.WarnLevel, tt.ttl, "tester")
+		// 第一次修改的定时器到期之后不能恢复级别
+		time.Sleep(100 * time.Millisecond)
+		if l := Level(); l != zapcore.WarnLevel {
+			t.Errorf("%s: level = %s, want warn", tt.name, l)
+		}
+		if got := Status(); (got.ExpiresAt == nil) != (tt.ttl == 0) || (got.ExpiresAt != nil && !got.ExpiresAt.Equal(*s.ExpiresAt)) {
+			t.Errorf("%s: expires_at = %v, want %v", tt.name, got.ExpiresAt, s.ExpiresAt)
+		}
+	}
+	resetLevel(zapcore.InfoLevel)
+}
+
+func TestReloadDuringTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured zapcore.Level // 热加载之后配置中的级别
+		want       zapcore.Level // 热加载之后生效的级别
+		wantExpiry bool
+	}{
+		// log.level 变化了，以配置为准，临时修改的级别和定时器都作废
+		{"level changed", zapcore.WarnLevel, zapcore.WarnLevel, false},
+		// log.level 没有变化（例如只改了别的配置项），保留临时修改的级别
+		{"level unchanged", zapcore.InfoLevel, zapcore.DebugLevel, true},
+	}
+	for _, tt := range tests {
+		resetLevel(zapcore.InfoLevel)
+		SetLevel(zapcore.DebugLevel, 50*time.Millisecond, "tester")
+		setConfigured(tt.configured)
+		if l := Level(); l != tt.want {
+			t.Errorf("%s: level = %s after reload, want %s", tt.name, l, tt.want)
+		}
+		if s := Status(); (s.ExpiresAt != nil) != tt.wantExpiry || s.Configured != tt.configured.String() {
+			t.Errorf("%s: unexpected status %+v", tt.name, s)
+		}
+		// 到期之后都是配置中的级别
+		time.Sleep(100 * time.Millisecond)
+		if l := Level(); l != tt.configured {
+			t.Errorf("%s: level = %s after the ttl, want %s", tt.name, l, tt.configured)
+		}
+	}
+	resetLevel(zapcore.InfoLevel)
+}
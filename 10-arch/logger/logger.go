@@ -2,129 +2,340 @@ package logger
 
 import (
 	"go-web/10-arch/settings"
-	"net"
+	"go-web/ginzap"
 	"net/http"
-	"net/http/httputil"
 	"os"
-	"runtime/debug"
-	"strings"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-// InitLogger 初始化Logger
-func Init(cfg *settings.LogConfig) (err error) {
-	writeSyncer := getLogWriter(
-		cfg.Filename,
-		cfg.MaxSize,
-		cfg.MaxBackups,
-		cfg.MaxAge,
-	)
-	encoder := getEncoder()
+// fileWriter 日志文件的 writer：自己切割的 rotator 或者配合 logrotate 使用的 reopener
+type fileWriter interface {
+	zapcore.WriteSyncer
+	Close() error
+}
+
+// fileOptions 影响日志文件 writer 的配置，重新初始化时这些配置没有变化的文件继续使用原来的 writer
+type fileOptions struct {
+	writer     string
+	rotate     string
+	maxSize    int
+	maxTotal   int
+	maxBackups int
+	maxAge     int
+	compress   bool
+	localTime  bool
+}
+
+func newFileOptions(cfg *settings.LogConfig) fileOptions {
+	return fileOptions{
+		writer:     cfg.Writer,
+		rotate:     cfg.Rotate,
+		maxSize:    cfg.MaxSize,
+		maxTotal:   cfg.MaxTotalSize,
+		maxBackups: cfg.MaxBackups,
+		maxAge:     cfg.MaxAge,
+		compress:   cfg.Compress,
+		localTime:  cfg.LocalTime,
+	}
+}
+
+// openFile 打开的日志文件和打开时使用的配置
+type openFile struct {
+	w    fileWriter
+	opts fileOptions
+}
 
-	var l = new(zapcore.Level)
-	err = l.UnmarshalText([]byte(cfg.Level))
+// closeDelay 重新初始化之后旧的 writer 延迟关闭的时间
+// 请求开始时取到的 logger、异步写日志的队列在这段时间内还会继续写旧的 writer
+const closeDelay = 30 * time.Second
+
+// writers 当前使用的 writer，files 按文件名记录当前打开的日志文件
+// retired 重新初始化之后不再使用、等待关闭的 writer
+var (
+	mu      sync.Mutex
+	writers []fileWriter
+	files   = make(map[string]openFile)
+	retired []fileWriter
+	once    sync.Once
+
+	// buildMu 保证同一时间只有一个 build 在执行
+	buildMu sync.Mutex
+)
+
+// InitLogger 初始化Logger，日志输出的默认值取决于 mode
+// 配置热加载时只有 log.level 变化的话直接修改日志级别，其他配置或者 mode 变化时按新的配置重新初始化
+func Init(cfg *settings.LogConfig, mode string) (err error) {
+	if err = build(cfg, mode); err != nil {
+		return err
+	}
+	once.Do(func() {
+		redirect()
+		settings.Subscribe(settings.SectionApp, func(old, new *settings.AppConfig) error {
+			if old.Mode == new.Mode {
+				return nil
+			}
+			return build(new.LogConfig, new.Mode)
+		})
+		settings.Subscribe(settings.SectionLog, func(old, new *settings.AppConfig) error {
+			o, n := *old.LogConfig, *new.LogConfig
+			o.Level, n.Level = "", ""
+			if reflect.DeepEqual(o, n) {
+				l, err := parseLevel(new.LogConfig.Level)
+				if err != nil {
+					return err
+				}
+				setConfigured(l)
+				return nil
+			}
+			return build(new.LogConfig, new.Mode)
+		})
+	})
+	return nil
+}
+
+func parseLevel(text string) (zapcore.Level, error) {
+	var l zapcore.Level
+	err := l.UnmarshalText([]byte(text))
+	return l, err
+}
+
+// build 按配置创建 logger 并替换全局的 logger
+// 每个输出对应一个 core，用 zapcore.NewTee 组合在一起
+// 配置没有变化的日志文件继续使用原来的 writer，其他旧的 writer 等 closeDelay 之后再关闭
+func build(cfg *settings.LogConfig, mode string) (err error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	l, err := parseLevel(cfg.Level)
 	if err != nil {
 		return err
 	}
-	core := zapcore.NewCore(encoder, writeSyncer, l)
 
-	lg := zap.New(core, zap.AddCaller())
+	mu.Lock()
+	prev := files
+	mu.Unlock()
+	var (
+		cores  []zapcore.Core
+		opts   = newFileOptions(cfg)
+		next   = make(map[string]openFile)
+		opened []fileWriter
+	)
+	for _, s := range sinks(cfg, mode) {
+		min := zapcore.DebugLevel
+		if s.Level != "" {
+			if min, err = parseLevel(s.Level); err != nil {
+				return err
+			}
+		}
+		var ws zapcore.WriteSyncer
+		switch s.Output {
+		case "stdout":
+			ws = zapcore.Lock(os.Stdout)
+		case "stderr":
+			ws = zapcore.Lock(os.Stderr)
+		default:
+			// 多个输出写同一个文件时共用一个 writer，避免切割的时候互相干扰
+			f, ok := next[s.Filename]
+			if !ok {
+				if f, ok = prev[s.Filename]; !ok || f.opts != opts {
+					f = openFile{opts: opts}
+					if cfg.Writer == "reopen" {
+						f.w = newReopener(s.Filename)
+					} else {
+						f.w = getLogWriter(s.Filename, cfg)
+					}
+				}
+				next[s.Filename] = f
+				opened = append(opened, f.w)
+			}
+			ws = f.w
+		}
+		if cfg.Async.Enabled {
+			// 异步写入时 writer 要在它包装的文件之后关闭，见下面倒序关闭
+			aw := newAsyncWriter(ws, cfg.Async)
+			opened = append(opened, aw)
+			cores = append(cores, newAsyncCore(getEncoder(s), aw, sinkLevel(min)))
+			continue
+		}
+		cores = append(cores, zapcore.NewCore(getEncoder(s), ws, sinkLevel(min)))
+	}
+	// 最近的日志保存在内存中，供管理接口查询和实时查看
+	recent.resize(cfg.RecentSize)
+	if cfg.RecentSize > 0 {
+		cores = append(cores, &ringCore{LevelEnabler: level})
+	}
+	// panic 和 error 日志发送通知
+	if cfg.Notify.Webhook != "" {
+		min, err := parseLevel(cfg.Notify.Level)
+		if err != nil {
+			return err
+		}
+		cores = append(cores, &notifyCore{LevelEnabler: min})
+	}
+	setNotifier(cfg.Notify)
+	setConfigured(l)
+	setPolicy(cfg.Redact)
+
+	lg := zap.New(zapcore.NewTee(cores...), zap.AddCaller())
 	// 替换 zap 库中全局的 logger
 	zap.ReplaceGlobals(lg)
 	// 这样子替换以后，在其他的包里面就可以使用:  zap.L().Info()  zap.L().Error()
+
+	inUse := make(map[fileWriter]bool, len(opened))
+	for _, w := range opened {
+		inUse[w] = true
+	}
+	mu.Lock()
+	var stale []fileWriter
+	for _, w := range writers {
+		if !inUse[w] {
+			stale = append(stale, w)
+		}
+	}
+	writers, files = opened, next
+	retired = append(retired, stale...)
+	mu.Unlock()
+	if len(stale) > 0 {
+		time.AfterFunc(closeDelay, func() { closeRetired(stale) })
+	}
 	return nil
 }
 
-func getEncoder() zapcore.Encoder {
+// closeRetired 关闭 ws 中还没有关闭的旧 writer，ws 为 nil 时关闭全部
+func closeRetired(ws []fileWriter) {
+	drop := make(map[fileWriter]bool, len(ws))
+	for _, w := range ws {
+		drop[w] = true
+	}
+	mu.Lock()
+	var closing, rest []fileWriter
+	for _, w := range retired {
+		if ws == nil || drop[w] {
+			closing = append(closing, w)
+		} else {
+			rest = append(rest, w)
+		}
+	}
+	retired = rest
+	mu.Unlock()
+	// 倒序关闭，异步 writer 先把队列中的日志写到文件中，然后再关闭文件
+	for i := len(closing) - 1; i >= 0; i-- {
+		_ = closing[i].Close()
+	}
+}
+
+// Sync 刷新当前 logger 的缓冲，开启了异步写日志时会等队列中的日志全部写完再返回
+// logger 可能因为配置热加载被替换过，退出前要用它代替 defer zap.L().Sync()
+// 同时把还没发出去的通知和重复的汇总发完，之后不再发送通知，重新初始化之后等待关闭的旧 writer 也马上关闭
+func Sync() error {
+	closeNotifier()
+	closeRetired(nil)
+	return zap.L().Sync()
+}
+
+// Reopen 重新打开所有的日志文件，log.writer 为 reopen 时在收到 SIGUSR1 之后调用
+func Reopen() error {
+	mu.Lock()
+	ws := writers
+	mu.Unlock()
+	var err error
+	for _, w := range ws {
+		if r, ok := w.(*reopener); ok {
+			if e := r.Reopen(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// sinkLevel 输出的级别同时受 log.level 和输出自己的最低级别控制
+func sinkLevel(min zapcore.Level) zap.LevelEnablerFunc {
+	return func(l zapcore.Level) bool {
+		return l >= min && level.Enabled(l)
+	}
+}
+
+func getEncoder(s settings.SinkConfig) zapcore.Encoder {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	encoderConfig.TimeKey = "time"
 	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 	encoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
 	encoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	return zapcore.NewJSONEncoder(encoderConfig)
-}
-
-func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.WriteSyncer {
-	lumberJackLogger := &lumberjack.Logger{
-		Filename:   filename,
-		MaxSize:    maxSize,
-		MaxBackups: maxBackup,
-		MaxAge:     maxAge,
+	if s.Encoder == "console" {
+		// 输出到终端时给级别加上颜色，写文件时不加，避免文件中出现转义字符
+		if s.Output != "file" {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encoderConfig)
 	}
-	return zapcore.AddSync(lumberJackLogger)
+	return zapcore.NewJSONEncoder(encoderConfig)
 }
 
-// GinLogger 接收gin框架默认的日志
+// GinLogger 接收gin框架默认的日志，查询参数按 log.redact 脱敏，5xx 的请求记录为 error
+// 使用请求的 logger，日志中带有请求 ID
+// http.capture.routes 中的接口还会记录请求体和响应体，同样按 log.redact 脱敏
 func GinLogger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
-		c.Next()
+	return ginzap.Logger(
+		ginzap.WithLoggerFunc(accessLogger),
+		ginzap.WithRouteTemplate(),
+		ginzap.WithStatusLevel(5, zapcore.ErrorLevel),
+		ginzap.WithQueryFilter(func(q string) string { return currentPolicy().rawQuery(q) }),
+		ginzap.WithBodyCapture(capture),
+	)
+}
 
-		cost := time.Since(start)
-		zap.L().Info(path,
-			zap.Int("status", c.Writer.Status()),
-			zap.String("method", c.Request.Method),
-			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
-			zap.String("user-agent", c.Request.UserAgent()),
-			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
-			zap.Duration("cost", cost),
-		)
+// capture 按 http.capture 判断请求是否需要记录请求体和响应体
+func capture(c *gin.Context) *ginzap.Capture {
+	app := settings.Current()
+	if app == nil || app.HTTPConfig == nil {
+		return nil
 	}
+	cfg := app.HTTPConfig
+	for _, route := range cfg.Capture.Routes {
+		if ginzap.MatchRoute(route, c) {
+			return &ginzap.Capture{
+				MaxBytes:     cfg.Capture.MaxBytes,
+				ContentTypes: cfg.Capture.ContentTypes,
+				Filter:       currentPolicy().capturedBody,
+			}
+		}
+	}
+	return nil
 }
 
 // GinRecovery recover掉项目可能出现的panic，并使用zap记录相关日志
+// Authorization、Cookie 等请求头和敏感的查询参数脱敏之后再记录，JSON 和表单的请求体按 log.redact.body 脱敏之后一起记录
+// 配置了 log.notify.webhook 时按调用栈去重之后发送通知
 func GinRecovery(stack bool) gin.HandlerFunc {
+	recovery := ginzap.Recovery(
+		ginzap.WithLoggerFunc(requestLogger),
+		ginzap.WithStack(stack),
+		ginzap.WithRequestDump(func(r *http.Request) []byte { return currentPolicy().dumpRequest(r) }),
+		ginzap.WithPanicHandler(notifyPanic),
+	)
 	return func(c *gin.Context) {
-		defer func() {
-			if err := recover(); err != nil {
-				// Check for a broken connection, as it is not really a
-				// condition that warrants a panic stack trace.
-				var brokenPipe bool
-				if ne, ok := err.(*net.OpError); ok {
-					if se, ok := ne.Err.(*os.SyscallError); ok {
-						if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-							brokenPipe = true
-						}
-					}
-				}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = &bodyRecorder{ReadCloser: c.Request.Body}
+		}
+		recovery(c)
+	}
+}
 
-				httpRequest, _ := httputil.DumpRequest(c.Request, false)
-				if brokenPipe {
-					zap.L().Error(c.Request.URL.Path,
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-					)
-					// If the connection is dead, we can't write a status to it.
-					c.Error(err.(error)) // nolint: errcheck
-					c.Abort()
-					return
-				}
+func requestLogger(c *gin.Context) *zap.Logger {
+	return FromContext(c)
+}
 
-				if stack {
-					zap.L().Error("[Recovery from panic]",
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-						zap.String("stack", string(debug.Stack())),
-					)
-				} else {
-					zap.L().Error("[Recovery from panic]",
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-					)
-				}
-				c.AbortWithStatus(http.StatusInternalServerError)
-			}
-		}()
-		c.Next()
+// accessLogger 访问日志的 logger，panic 已经通知过的请求不再按 500 的访问日志重复通知
+func accessLogger(c *gin.Context) *zap.Logger {
+	if c.GetBool(panicNotified) {
+		return FromContext(c).With(notifiedField)
 	}
+	return FromContext(c)
 }
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"go-web/10-arch/settings"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func fileConfig(dir string) *settings.LogConfig {
+	return &settings.LogConfig{
+		Level:    "info",
+		Filename: filepath.Join(dir, "app.log"),
+		Writer:   "rotate",
+		Sinks:    []settings.SinkConfig{{Encoder: "json", Output: "file"}},
+	}
+}
+
+func TestBuildKeepsUnchangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer Sync()
+
+	cfg := fileConfig(dir)
+	if err := build(cfg, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	// 前面的测试留下来的旧 writer 先关掉
+	closeRetired(nil)
+	before := files[cfg.Filename].w
+	// 请求开始时取到的 logger，重新初始化之后还会继续使用
+	old := zap.L()
+
+	cfg.Async = settings.AsyncConfig{Enabled: true, QueueSize: 16, Policy: policyBlock}
+	if err := build(cfg, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if files[cfg.Filename].w != before {
+		t.Fatal("the writer of an unchanged file was replaced")
+	}
+	if len(retired) != 0 {
+		t.Fatalf("retired %d writers, want 0", len(retired))
+	}
+	old.Info("from the old logger")
+	zap.L().Info("from the new logger")
+
+	// 切割的配置变了，打开新的 writer，旧的等待延迟关闭
+	cfg.MaxSize = 100
+	if err := build(cfg, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if files[cfg.Filename].w == before {
+		t.Fatal("the writer was kept although its options changed")
+	}
+	if len(retired) != 2 {
+		t.Fatalf("retired %d writers, want the old file and its async writer", len(retired))
+	}
+	if err := Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(retired) != 0 {
+		t.Fatal("Sync did not close the retired writers")
+	}
+
+	data, err := ioutil.ReadFile(cfg.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"from the old logger", "from the new logger"} {
+		if !strings.Contains(string(data), msg) {
+			t.Errorf("log file is missing %q", msg)
+		}
+	}
+}
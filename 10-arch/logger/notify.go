@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"go-web/10-arch/pkg/notify"
+	"go-web/10-arch/settings"
+	"go-web/ginzap"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	notifyMu  sync.Mutex
+	notifier  *notify.Dedup // 没有配置 log.notify.webhook 时为 nil
+	notifyCfg settings.NotifyConfig
+)
+
+// panicNotified notifyPanic 通知过的请求在 gin.Context 中设置这个 key
+const panicNotified = "logger.panic_notified"
+
+// notifiedField 加在已经通知过 panic 的请求的访问日志上，notifyCore 看到它就不再通知
+// SkipType 的字段编码器会忽略，不会出现在日志中
+var notifiedField = zap.Field{Key: panicNotified, Type: zapcore.SkipType}
+
+// setNotifier 按配置替换通知，旧的通知在后台关闭，把还没发出去的汇总发完
+// log.notify 没有变化时继续使用原来的通知，保留去重的状态
+func setNotifier(cfg settings.NotifyConfig) {
+	notifyMu.Lock()
+	if notifier != nil && cfg == notifyCfg {
+		notifyMu.Unlock()
+		return
+	}
+	notifyMu.Unlock()
+	var n *notify.Dedup
+	if cfg.Webhook != "" {
+		wh := notify.NewWebhook(cfg.Webhook, []byte(cfg.Secret.Value()), cfg.Timeout)
+		n = notify.NewDedup(wh, cfg.Interval, cfg.Timeout, 256)
+	}
+	notifyMu.Lock()
+	old := notifier
+	notifier, notifyCfg = n, cfg
+	notifyMu.Unlock()
+	if old != nil {
+		go old.Close()
+	}
+}
+
+func currentNotifier() *notify.Dedup {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+	return notifier
+}
+
+// closeNotifier 退出前把队列中的通知发完
+func closeNotifier() {
+	notifyMu.Lock()
+	n := notifier
+	notifier = nil
+	notifyMu.Unlock()
+	if n != nil {
+		_ = n.Close()
+	}
+}
+
+func serviceName() string {
+	if c := settings.Current(); c != nil {
+		return c.Name
+	}
+	return ""
+}
+
+// notifyPanic GinRecovery 记录完 panic 之后发送通知，按 panic 的调用栈去重
+func notifyPanic(c *gin.Context, err interface{}, stack []byte) {
+	n := currentNotifier()
+	if n == nil {
+		return
+	}
+	c.Set(panicNotified, true)
+	_ = n.Notify(context.Background(), notify.Event{
+		Kind:      notify.KindPanic,
+		Service:   serviceName(),
+		Level:     zapcore.ErrorLevel.CapitalString(),
+		Message:   fmt.Sprint(err),
+		RequestID: c.Writer.Header().Get("X-Request-ID"),
+		Fields: map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"route":  c.FullPath(),
+		},
+		Stack:       string(stack),
+		Fingerprint: notify.Fingerprint(string(stack), fmt.Sprintf("%T", err)),
+	})
+}
+
+// notifyCore 达到 log.notify.level 的日志发送通知，按 logger、消息、调用位置和调用栈去重
+// GinRecovery 记录的 panic 日志以及这个请求 500 的访问日志由 notifyPanic 通知，这里跳过
+type notifyCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+func (c *notifyCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(append(all, c.fields...), fields...)
+	return &notifyCore{LevelEnabler: c.LevelEnabler, fields: all}
+}
+
+func (c *notifyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) && ent.Message != ginzap.PanicMessage {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *notifyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	n := currentNotifier()
+	if n == nil {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		if f.Equals(notifiedField) {
+			return nil
+		}
+		f.AddTo(enc)
+	}
+	if ent.Stack == "" {
+		// 级别低于 zap.AddStacktrace 的日志没有调用栈，自己取一个用来去重
+		ent.Stack = callerStack()
+	}
+	e := notify.Event{
+		Kind:    notify.KindError,
+		Service: serviceName(),
+		Level:   ent.Level.CapitalString(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		Stack:   ent.Stack,
+		Time:    ent.Time,
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+	if id, ok := enc.Fields["request_id"].(string); ok {
+		e.RequestID = id
+		delete(enc.Fields, "request_id")
+	}
+	if len(enc.Fields) > 0 {
+		e.Fields = enc.Fields
+	}
+	e.Fingerprint = notify.Fingerprint(ent.Stack, ent.LoggerName, ent.Message, e.Caller)
+	return n.Notify(context.Background(), e)
+}
+
+func (c *notifyCore) Sync() error {
+	return nil
+}
+
+// callerStack 返回写日志的地方的调用栈，格式和 zap 的 stacktrace 一样，去掉 zap 和 notifyCore 自己的调用
+func callerStack() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "go.uber.org/zap") {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "%s\n\t%s:%d", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"go-web/10-arch/pkg/notify"
+	"go-web/10-arch/settings"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// webhook 记录收到的通知
+type webhook struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e notify.Event
+	_ = json.NewDecoder(r.Body).Decode(&e)
+	h.mu.Lock()
+	h.events = append(h.events, e)
+	h.mu.Unlock()
+}
+
+func notifyConfig(dir, url string) *settings.LogConfig {
+	cfg := fileConfig(dir)
+	cfg.Notify = settings.NotifyConfig{Webhook: url, Level: "error", Interval: time.Minute, Timeout: time.Second}
+	return cfg
+}
+
+func (h *webhook) received() []notify.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events
+}
+
+func TestPanicNotifiedOnce(t *testing.T) {
+	h := &webhook{}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := build(notifyConfig(dir, srv.URL), "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(GinLogger(), GinRecovery(true))
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	// 关闭通知，等队列中的通知发送完
+	_ = Sync()
+
+	if events := h.received(); len(events) != 1 || events[0].Kind != notify.KindPanic {
+		t.Fatalf("got %d notifications %+v, want a single panic", len(events), events)
+	}
+}
+
+func TestNotifierKeptAcrossReload(t *testing.T) {
+	h := &webhook{}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := notifyConfig(dir, srv.URL)
+	if err := build(cfg, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	before := currentNotifier()
+	// 同一个位置的错误指纹相同，第二次在重新初始化之后
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			// 只改了和通知无关的配置，去重的状态要保留下来，重复的错误不再通知
+			cfg.RecentSize = 10
+			if err := build(cfg, "prod"); err != nil {
+				t.Fatal(err)
+			}
+			if currentNotifier() != before {
+				t.Fatal("notifier was replaced although log.notify did not change")
+			}
+		}
+		zap.L().Error("db down", zap.Error(errors.New("timeout")))
+	}
+
+	cfg.Notify.Interval = 2 * time.Minute
+	if err := build(cfg, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if currentNotifier() == before {
+		t.Fatal("notifier was kept although log.notify changed")
+	}
+	// 旧的通知在后台关闭，等它把汇总发完
+	_ = before.Close()
+	_ = Sync()
+
+	// 第一次的通知，加上替换通知时旧的通知汇总的一次重复
+	events := h.received()
+	if len(events) != 2 || events[0].Kind != notify.KindError || events[1].Kind != notify.KindDigest {
+		t.Fatalf("unexpected notifications: %+v", events)
+	}
+	e := events[0]
+	if !strings.Contains(e.Stack, "TestNotifierKeptAcrossReload") || strings.Contains(e.Stack, "go.uber.org/zap") {
+		t.Fatalf("stack should start at the caller of the logger:\n%s", e.Stack)
+	}
+}
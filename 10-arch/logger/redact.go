@@ -0,0 +1,245 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-web/10-arch/settings"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// redactor 日志脱敏的规则，随日志配置一起更新
+type redactor struct {
+	headers map[string]bool // http.CanonicalHeaderKey 之后的请求头
+	query   map[string]bool // 小写的查询参数名
+	body    [][]string      // 按 . 拆开的 JSON 字段路径
+	salt    []byte
+}
+
+var policy atomic.Value // *redactor
+
+// setPolicy 按配置更新脱敏规则
+func setPolicy(cfg settings.RedactConfig) {
+	r := &redactor{
+		headers: make(map[string]bool),
+		query:   make(map[string]bool),
+		salt:    []byte(cfg.Salt.Value()),
+	}
+	for _, h := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, q := range cfg.Query {
+		r.query[strings.ToLower(q)] = true
+	}
+	for _, p := range cfg.Body {
+		r.body = append(r.body, strings.Split(p, "."))
+	}
+	policy.Store(r)
+}
+
+func currentPolicy() *redactor {
+	if r, ok := policy.Load().(*redactor); ok {
+		return r
+	}
+	return &redactor{}
+}
+
+// mask 返回脱敏之后的值
+// 配置了 salt 时返回加盐哈希的前 16 位，相同的值脱敏之后仍然相同，可以用来关联同一个 token 的请求
+func (r *redactor) mask(v string) string {
+	if len(r.salt) == 0 {
+		return settings.Mask
+	}
+	h := hmac.New(sha256.New, r.salt)
+	h.Write([]byte(v))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// header 返回脱敏之后的请求头副本，不修改原来的请求头
+func (r *redactor) header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, vs := range h {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			masked := make([]string, len(vs))
+			for i, v := range vs {
+				masked[i] = r.mask(v)
+			}
+			out[k] = masked
+			continue
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+// rawQuery 对查询字符串中敏感的参数脱敏，其他参数和顺序保持不变
+func (r *redactor) rawQuery(q string) string {
+	return r.pairs(q, func(key string) bool { return r.query[strings.ToLower(key)] })
+}
+
+// form 对 application/x-www-form-urlencoded 的内容脱敏，查询参数的规则和只有一级的 JSON 字段路径都生效
+func (r *redactor) form(q string) string {
+	return r.pairs(q, func(key string) bool {
+		if r.query[strings.ToLower(key)] {
+			return true
+		}
+		for _, p := range r.body {
+			if len(p) == 1 && p[0] == key {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// pairs 对 k=v&k=v 形式的内容中 sensitive 返回 true 的参数脱敏
+func (r *redactor) pairs(q string, sensitive func(key string) bool) string {
+	if q == "" || (len(r.query) == 0 && len(r.body) == 0) {
+		return q
+	}
+	pairs := strings.Split(q, "&")
+	for i, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		if !sensitive(key) {
+			continue
+		}
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			value = kv[1]
+		}
+		pairs[i] = kv[0] + "=" + r.mask(value)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// dumpRequest 和 httputil.DumpRequest 一样，但是请求头和查询参数按规则脱敏
+// 请求体只有 GinRecovery 记录下来的 JSON 和表单，按 log.redact.body 脱敏，其他类型的请求体不记录
+func (r *redactor) dumpRequest(req *http.Request) []byte {
+	cp := *req
+	cp.Header = r.header(req.Header)
+	if req.URL != nil {
+		u := *req.URL
+		u.RawQuery = r.rawQuery(u.RawQuery)
+		cp.URL = &u
+		// 服务端收到的请求 DumpRequest 输出的是 RequestURI，同样要用脱敏之后的
+		if cp.RequestURI != "" {
+			cp.RequestURI = u.RequestURI()
+		}
+	}
+	b, _ := httputil.DumpRequest(&cp, false)
+	if rec, ok := req.Body.(*bodyRecorder); ok && rec.buf.Len() > 0 {
+		ct := req.Header.Get("Content-Type")
+		if mt, _, _ := mime.ParseMediaType(ct); mt == "application/json" || mt == "application/x-www-form-urlencoded" {
+			b = append(b, r.capturedBody(ct, rec.buf.Bytes(), rec.truncated)...)
+		}
+	}
+	return b
+}
+
+// panicBodyBytes panic 日志中最多记录多少字节的请求体
+const panicBodyBytes = 4096
+
+// bodyRecorder 记录 handler 读到的请求体的前 panicBodyBytes 个字节，panic 时和请求一起脱敏之后记录
+type bodyRecorder struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if left := panicBodyBytes - b.buf.Len(); n > left {
+		b.buf.Write(p[:left])
+		b.truncated = true
+	} else {
+		b.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// capturedBody 对访问日志中记录的请求体、响应体脱敏
+// 被截断的 JSON 没法解析，配置了需要脱敏的字段时不记录内容，只记录长度，避免敏感字段漏出去
+func (r *redactor) capturedBody(contentType string, b []byte, truncated bool) string {
+	if mt, _, _ := mime.ParseMediaType(contentType); mt == "application/x-www-form-urlencoded" {
+		return r.form(string(b))
+	}
+	if len(r.body) == 0 {
+		return string(b)
+	}
+	if !truncated {
+		if out, ok := r.jsonBody(b); ok {
+			return string(out)
+		}
+	}
+	return fmt.Sprintf("[%d bytes omitted: cannot redact]", len(b))
+}
+
+// jsonBody 对 JSON 内容中配置的字段脱敏，不是合法的 JSON 时返回 false
+func (r *redactor) jsonBody(b []byte) ([]byte, bool) {
+	if len(r.body) == 0 {
+		return b, true
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, false
+	}
+	for _, path := range r.body {
+		v = r.redactPath(v, path)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// redactPath 沿着 path 找到对应的字段并脱敏，路径上遇到数组时对每个元素处理
+func (r *redactor) redactPath(v interface{}, path []string) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		for i := range x {
+			x[i] = r.redactPath(x[i], path)
+		}
+		return x
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return v
+		}
+		child, ok := x[path[0]]
+		if !ok {
+			return v
+		}
+		if len(path) == 1 {
+			x[path[0]] = r.maskValue(child)
+		} else {
+			x[path[0]] = r.redactPath(child, path[1:])
+		}
+		return x
+	}
+	return v
+}
+
+// maskValue 字段的值是对象或者数组时整个替换掉
+func (r *redactor) maskValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return r.mask(s)
+	}
+	b, _ := json.Marshal(v)
+	return r.mask(string(b))
+}
@@ -0,0 +1,216 @@
+package logger
+
+import (
+	"go-web/10-arch/settings"
+	"go-web/ginzap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func testPolicy(salt string) *redactor {
+	setPolicy(settings.RedactConfig{
+		Headers: []string{"authorization", "Cookie"},
+		Query:   []string{"token"},
+		Body:    []string{"password", "user.id_card"},
+		Salt:    settings.Secret(salt),
+	})
+	return currentPolicy()
+}
+
+func TestRedactHeader(t *testing.T) {
+	r := testPolicy("")
+	h := http.Header{"Authorization": {"Bearer abc"}, "Cookie": {"a=1", "b=2"}, "Accept": {"*/*"}}
+	out := r.header(h)
+	if out.Get("Authorization") != settings.Mask || out["Cookie"][1] != settings.Mask || out.Get("Accept") != "*/*" {
+		t.Fatalf("unexpected headers: %v", out)
+	}
+	if h.Get("Authorization") != "Bearer abc" {
+		t.Fatal("the original header was modified")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	r := testPolicy("")
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"a=1&b=2", "a=1&b=2"},
+		{"a=1&TOKEN=abc&b=2", "a=1&TOKEN=******&b=2"},
+		{"flag&token=a%20b", "flag&token=******"},
+		// 参数名是转义之后的也能识别
+		{"t%6Fken=abc", "t%6Fken=******"},
+	}
+	for _, tt := range tests {
+		if got := r.rawQuery(tt.in); got != tt.want {
+			t.Errorf("rawQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactSalted(t *testing.T) {
+	r := testPolicy("salt")
+	a, b, c := r.mask("abc"), r.mask("abc"), r.mask("abd")
+	if a != b || a == c || !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+16 {
+		t.Fatalf("unexpected salted masks %q %q %q", a, b, c)
+	}
+	if r.rawQuery("token=abc") != "token="+a {
+		t.Fatal("query parameters should use the salted hash")
+	}
+}
+
+func TestRedactJSONBody(t *testing.T) {
+	r := testPolicy("")
+	tests := []struct{ in, want string }{
+		{`{"name":"a","password":"p"}`, `{"name":"a","password":"******"}`},
+		{`{"user":{"id_card":"110","name":"a"}}`, `{"user":{"id_card":"******","name":"a"}}`},
+		// 数组中的每个元素都处理，对象和数组类型的值整个替换
+		{`[{"password":"p"},{"password":{"old":"p"}}]`, `[{"password":"******"},{"password":"******"}]`},
+		{`{"users":[{"password":"p"}]}`, `{"users":[{"password":"p"}]}`},
+		{`{"name":"a"}`, `{"name":"a"}`},
+	}
+	for _, tt := range tests {
+		got, ok := r.jsonBody([]byte(tt.in))
+		if !ok || string(got) != tt.want {
+			t.Errorf("jsonBody(%s) = %s, %v; want %s", tt.in, got, ok, tt.want)
+		}
+	}
+	if _, ok := r.jsonBody([]byte(`{"password":`)); ok {
+		t.Error("invalid JSON should not be accepted")
+	}
+}
+
+func TestCapturedBody(t *testing.T) {
+	r := testPolicy("")
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		truncated   bool
+		want        string
+	}{
+		{"json", "application/json", `{"password":"p","name":"a"}`, false, `{"name":"a","password":"******"}`},
+		{"nested json", "application/json; charset=utf-8", `{"user":{"id_card":"110"}}`, false, `{"user":{"id_card":"******"}}`},
+		{"form", "application/x-www-form-urlencoded", "name=a&password=p&token=t", false, "name=a&password=******&token=******"},
+		// 被截断的 JSON 没法解析，不记录内容
+		{"truncated json", "application/json", `{"password":"p","na`, true, "[19 bytes omitted: cannot redact]"},
+		{"invalid json", "application/json", `{"password":`, false, "[12 bytes omitted: cannot redact]"},
+		// 被截断的表单仍然逐个参数脱敏
+		{"truncated form", "application/x-www-form-urlencoded", "password=p&na", true, "password=******&na"},
+	}
+	for _, tt := range tests {
+		if got := r.capturedBody(tt.contentType, []byte(tt.body), tt.truncated); got != tt.want {
+			t.Errorf("%s: capturedBody = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// 没有配置 body 的规则时原样记录
+	setPolicy(settings.RedactConfig{})
+	if got := currentPolicy().capturedBody("application/json", []byte(`{"password":"p`), true); got != `{"password":"p` {
+		t.Errorf("without body rules: %q", got)
+	}
+}
+
+// GinLogger 记录的请求体、响应体按规则脱敏，handler 仍然能读到原始的请求体
+func TestGinLoggerCapture(t *testing.T) {
+	testPolicy("")
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.L())
+	zap.ReplaceGlobals(zap.New(core))
+
+	r := gin.New()
+	r.Use(ginzap.Logger(
+		ginzap.WithLoggerFunc(accessLogger),
+		ginzap.WithBodyCapture(func(c *gin.Context) *ginzap.Capture {
+			return &ginzap.Capture{MaxBytes: 1024, ContentTypes: []string{"application/json"}, Filter: currentPolicy().capturedBody}
+		}),
+	))
+	var read string
+	r.POST("/login", func(c *gin.Context) {
+		var req struct{ Password string }
+		_ = c.ShouldBindJSON(&req)
+		read = req.Password
+		c.JSON(http.StatusOK, gin.H{"password": "new"})
+	})
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"password":"p@ss"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if read != "p@ss" {
+		t.Fatalf("handler read %q", read)
+	}
+	fields := logs.All()[0].ContextMap()
+	if fields["request_body"] != `{"password":"******"}` || fields["response_body"] != `{"password":"******"}` {
+		t.Fatalf("unexpected captured bodies: %v / %v", fields["request_body"], fields["response_body"])
+	}
+}
+
+func TestPanicDumpBody(t *testing.T) {
+	r := testPolicy("")
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		notWant     string
+	}{
+		{"json", "application/json; charset=utf-8", `{"name":"a","password":"p@ss"}`, `"password":"******"`, "p@ss"},
+		{"form", "application/x-www-form-urlencoded", "name=a&password=p%40ss", "password=******", "p%40ss"},
+		{"truncated json", "application/json", `{"password":"p@ss","pad":"` + strings.Repeat("x", panicBodyBytes) + `"}`, "bytes omitted", "p@ss"},
+		{"other types", "text/plain", "password=p@ss", "", "p@ss"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/users?token=abc", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("Authorization", "Bearer abc")
+		rec := &bodyRecorder{ReadCloser: req.Body}
+		req.Body = rec
+		// handler 读完了请求体
+		buf := make([]byte, 512)
+		for {
+			if _, err := req.Body.Read(buf); err != nil {
+				break
+			}
+		}
+
+		dump := string(r.dumpRequest(req))
+		if !strings.Contains(dump, tt.want) || strings.Contains(dump, tt.notWant) {
+			t.Errorf("%s: unexpected dump:\n%.300s", tt.name, dump)
+		}
+		if strings.Contains(dump, "Bearer abc") || strings.Contains(dump, "token=abc") {
+			t.Errorf("%s: header or query not redacted:\n%.300s", tt.name, dump)
+		}
+	}
+}
+
+func TestGinRecoveryDumpsBody(t *testing.T) {
+	testPolicy("")
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.L())
+	zap.ReplaceGlobals(zap.New(core))
+
+	r := gin.New()
+	r.Use(GinRecovery(false))
+	r.POST("/login", func(c *gin.Context) {
+		var req struct{ Password string }
+		_ = c.ShouldBindJSON(&req)
+		panic("boom")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"a","password":"p@ss"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.FilterMessage(ginzap.PanicMessage).All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d panic logs", len(entries))
+	}
+	dump := entries[0].ContextMap()["request"].(string)
+	if !strings.HasSuffix(dump, `{"password":"******","user":"a"}`) {
+		t.Fatalf("unexpected request dump:\n%s", dump)
+	}
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Writer 把写入的内容记录成 name 这个 logger 的日志，每次写入一条，适合 log、fmt.Fprintln 这样每次写一行的调用方
+// 每次写入时都取当前的全局 logger，重新初始化 logger 之后不需要重新设置
+type Writer struct {
+	name  string
+	level zapcore.Level
+	skip  int                                                            // 调用方到 Write、Print 之间的调用层数，用来找到实际打日志的位置
+	parse func(line string, level zapcore.Level) (zapcore.Level, string) // 从内容中识别日志级别，为 nil 时都使用 level
+}
+
+// NewWriter 创建一个 Writer，日志的级别为 level
+func NewWriter(name string, level zapcore.Level) *Writer {
+	return &Writer{name: name, level: level}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.log(string(p), w.skip+2)
+	return len(p), nil
+}
+
+// Print 实现 mysql.Logger 这样只有 Print 方法的日志接口
+func (w *Writer) Print(v ...interface{}) {
+	w.log(fmt.Sprint(v...), w.skip+2)
+}
+
+func (w *Writer) log(msg string, skip int) {
+	msg = strings.TrimRight(msg, "\n")
+	level := w.level
+	if w.parse != nil {
+		level, msg = w.parse(msg, level)
+	}
+	lg := zap.L().Named(w.name).WithOptions(zap.AddCallerSkip(skip))
+	if ce := lg.Check(level, msg); ce != nil {
+		ce.Write()
+	}
+}
+
+// redirect 把 gin 和标准库 log 的输出重定向到 zap，MySQL 驱动的日志在 dao/mysql 中设置
+//   - gin 打印的路由、调试信息记录为 gin 的 debug 日志，[WARNING] 记录为 warn，DefaultErrorWriter 中的内容记录为 error
+//   - 标准库 log 的输出记录为 stdlog 的 info 日志，调用 log.Printf 的位置作为 caller
+func redirect() {
+	// debugPrint -> fmt.Fprintf -> Writer.Write
+	gin.DefaultWriter = &Writer{name: "gin", level: zapcore.DebugLevel, skip: 1, parse: ginLevel}
+	gin.DefaultErrorWriter = &Writer{name: "gin", level: zapcore.ErrorLevel, skip: 1, parse: ginLevel}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		zap.L().Named("gin").Debug("route",
+			zap.String("method", method),
+			zap.String("path", path),
+			zap.String("handler", handler),
+			zap.Int("handlers", handlers),
+		)
+	}
+
+	log.SetFlags(0)
+	log.SetPrefix("")
+	// log.Printf -> log.Output -> Writer.Write
+	log.SetOutput(&Writer{name: "stdlog", level: zapcore.InfoLevel, skip: 2})
+}
+
+// ginLevel 去掉 gin 的 [GIN-debug] 前缀，按 [WARNING]、[ERROR] 标记确定日志级别，没有标记时使用 level
+func ginLevel(line string, level zapcore.Level) (zapcore.Level, string) {
+	line = strings.TrimPrefix(line, "[GIN-debug] ")
+	switch {
+	case strings.HasPrefix(line, "[WARNING] "):
+		return zapcore.WarnLevel, strings.TrimPrefix(line, "[WARNING] ")
+	case strings.HasPrefix(line, "[ERROR] "):
+		return zapcore.ErrorLevel, strings.TrimPrefix(line, "[ERROR] ")
+	}
+	return level, line
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"os"
+	"sync"
+)
+
+// reopener 只写普通文件，不做切割，收到 SIGUSR1 之后重新打开文件，配合系统的 logrotate 使用
+// logrotate 先把文件重命名再发信号，重新打开之前写入的日志会留在重命名之后的文件中，不会丢失
+type reopener struct {
+	mu       sync.Mutex
+	filename string
+	f        *os.File
+}
+
+func newReopener(filename string) *reopener {
+	return &reopener{filename: filename}
+}
+
+func (r *reopener) open() (*os.File, error) {
+	return os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func (r *reopener) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		f, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.f = f
+	}
+	return r.f.Write(p)
+}
+
+// Reopen 重新打开文件，新文件打开失败时继续写原来的文件
+func (r *reopener) Reopen() error {
+	f, err := r.open()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	old := r.f
+	r.f = f
+	r.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func (r *reopener) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Sync()
+}
+
+func (r *reopener) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
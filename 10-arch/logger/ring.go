@@ -0,0 +1,190 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry 内存中保存的一条日志
+type Entry struct {
+	Seq       uint64                 `json:"seq" yaml:"seq"`
+	Time      time.Time              `json:"time" yaml:"time"`
+	Level     string                 `json:"level" yaml:"level"`
+	Logger    string                 `json:"logger,omitempty" yaml:"logger,omitempty"`
+	Caller    string                 `json:"caller,omitempty" yaml:"caller,omitempty"`
+	Message   string                 `json:"msg" yaml:"msg"`
+	RequestID string                 `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	level zapcore.Level
+}
+
+// Query 查询内存中日志的条件，零值表示不过滤
+type Query struct {
+	Level     zapcore.Level // 最低的日志级别
+	RequestID string
+	Contains  string // 日志消息中包含的字符串
+	Limit     int    // 最多返回多少条，只对 Recent 生效
+}
+
+func (q Query) match(e *Entry) bool {
+	return e.level >= q.Level &&
+		(q.RequestID == "" || e.RequestID == q.RequestID) &&
+		(q.Contains == "" || strings.Contains(e.Message, q.Contains))
+}
+
+// ring 在内存中保留最近的日志，大小由 log.recent_size 配置，重新初始化 logger 时保留已有的日志
+type ring struct {
+	mu    sync.Mutex
+	buf   []Entry
+	start int // 最早的一条日志在 buf 中的位置
+	n     int
+	seq   uint64
+	subs  map[*tail]struct{}
+}
+
+// tail 实时查看日志的订阅者
+type tail struct {
+	q  Query
+	ch chan Entry
+}
+
+var recent = &ring{subs: make(map[*tail]struct{})}
+
+// resize 修改保留的条数，只保留最新的日志
+func (r *ring) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size == len(r.buf) {
+		return
+	}
+	entries := r.entries()
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	r.buf = make([]Entry, size)
+	r.start, r.n = 0, copy(r.buf, entries)
+}
+
+// entries 按时间顺序返回所有的日志，调用方需要持有 r.mu
+func (r *ring) entries() []Entry {
+	out := make([]Entry, 0, r.n)
+	for i := 0; i < r.n; i++ {
+		out = append(out, r.buf[(r.start+i)%len(r.buf)])
+	}
+	return out
+}
+
+func (r *ring) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	e.Seq = r.seq
+	if len(r.buf) > 0 {
+		if r.n < len(r.buf) {
+			r.buf[(r.start+r.n)%len(r.buf)] = e
+			r.n++
+		} else {
+			r.buf[r.start] = e
+			r.start = (r.start + 1) % len(r.buf)
+		}
+	}
+	// 订阅者处理不过来的时候丢弃，不能阻塞写日志
+	for t := range r.subs {
+		if t.q.match(&e) {
+			select {
+			case t.ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Recent 返回内存中符合条件的日志，按时间从旧到新排序，设置了 Limit 时返回最新的 Limit 条
+func Recent(q Query) []Entry {
+	recent.mu.Lock()
+	entries := recent.entries()
+	recent.mu.Unlock()
+
+	out := make([]Entry, 0)
+	for i := range entries {
+		if q.match(&entries[i]) {
+			out = append(out, entries[i])
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// Tail 订阅之后写入的符合条件的日志，不再需要时调用返回的 cancel
+func Tail(q Query) (<-chan Entry, func()) {
+	t := &tail{q: q, ch: make(chan Entry, 256)}
+	recent.mu.Lock()
+	recent.subs[t] = struct{}{}
+	recent.mu.Unlock()
+	var once sync.Once
+	return t.ch, func() {
+		once.Do(func() {
+			recent.mu.Lock()
+			delete(recent.subs, t)
+			recent.mu.Unlock()
+		})
+	}
+}
+
+// ringCore 把日志写到 recent 中
+type ringCore struct {
+	zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(append(all, c.fields...), fields...)
+	return &ringCore{LevelEnabler: c.LevelEnabler, fields: all}
+}
+
+func (c *ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	e := Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.CapitalString(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		level:   ent.Level,
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+	if id, ok := enc.Fields["request_id"].(string); ok {
+		e.RequestID = id
+		delete(enc.Fields, "request_id")
+	}
+	if len(enc.Fields) > 0 {
+		e.Fields = enc.Fields
+	}
+	recent.add(e)
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
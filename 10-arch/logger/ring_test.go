@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// messages 按顺序返回 ring 中日志的消息
+func messages(r *ring) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, e := range r.entries() {
+		out = append(out, e.Message)
+	}
+	return out
+}
+
+func addAll(r *ring, msgs ...string) {
+	for _, m := range msgs {
+		r.add(Entry{Message: m})
+	}
+}
+
+func TestRing(t *testing.T) {
+	r := &ring{subs: make(map[*tail]struct{})}
+	addAll(r, "dropped")
+	if got := messages(r); got != nil {
+		t.Errorf("size 0 keeps %v", got)
+	}
+
+	r.resize(3)
+	addAll(r, "a", "b")
+	if got, want := messages(r), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// 写满之后覆盖最早的日志
+	addAll(r, "c", "d", "e")
+	if got, want := messages(r), []string{"c", "d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after wraparound got %v, want %v", got, want)
+	}
+
+	// 缩小时只保留最新的日志
+	r.resize(2)
+	if got, want := messages(r), []string{"d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after shrink got %v, want %v", got, want)
+	}
+	// 扩大时保留已有的日志
+	r.resize(4)
+	addAll(r, "f")
+	if got, want := messages(r), []string{"d", "e", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after grow got %v, want %v", got, want)
+	}
+
+	// seq 在 resize 之后继续递增
+	r.mu.Lock()
+	entries := r.entries()
+	r.mu.Unlock()
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Seq <= entries[i-1].Seq {
+			t.Errorf("seq not increasing: %d after %d", entries[i].Seq, entries[i-1].Seq)
+		}
+	}
+	if last := entries[len(entries)-1].Seq; last != 7 {
+		t.Errorf("last seq = %d, want 7", last)
+	}
+}
+
+// useRing 在测试期间替换全局的 recent
+func useRing(size int) func() {
+	old := recent
+	recent = &ring{subs: make(map[*tail]struct{})}
+	recent.resize(size)
+	return func() { recent = old }
+}
+
+func TestRecent(t *testing.T) {
+	defer useRing(10)()
+	recent.add(Entry{Message: "debug msg", level: zapcore.DebugLevel})
+	recent.add(Entry{Message: "info msg", RequestID: "r1", level: zapcore.InfoLevel})
+	recent.add(Entry{Message: "warn msg", RequestID: "r2", level: zapcore.WarnLevel})
+	recent.add(Entry{Message: "error msg", RequestID: "r1", level: zapcore.ErrorLevel})
+
+	tests := []struct {
+		q    Query
+		want []string
+	}{
+		{Query{Level: zapcore.DebugLevel}, []string{"debug msg", "info msg", "warn msg", "error msg"}},
+		{Query{Level: zapcore.WarnLevel}, []string{"warn msg", "error msg"}},
+		{Query{Level: zapcore.DebugLevel, RequestID: "r1"}, []string{"info msg", "error msg"}},
+		{Query{Level: zapcore.DebugLevel, Contains: "warn"}, []string{"warn msg"}},
+		{Query{Level: zapcore.DebugLevel, Limit: 2}, []string{"warn msg", "error msg"}},
+		{Query{Level: zapcore.FatalLevel}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range Recent(tt.q) {
+			got = append(got, e.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Recent(%+v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	defer useRing(0)()
+	ch, cancel := Tail(Query{Level: zapcore.WarnLevel})
+	recent.add(Entry{Message: "info msg", level: zapcore.InfoLevel})
+	recent.add(Entry{Message: "warn msg", level: zapcore.WarnLevel})
+
+	select {
+	case e := <-ch:
+		if e.Message != "warn msg" {
+			t.Errorf("got %q, want warn msg", e.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no entry received")
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected entry %q", e.Message)
+	default:
+	}
+
+	cancel()
+	cancel()
+	recent.add(Entry{Message: "after cancel", level: zapcore.ErrorLevel})
+	select {
+	case e := <-ch:
+		t.Errorf("received %q after cancel", e.Message)
+	default:
+	}
+}
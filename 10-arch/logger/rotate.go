@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"fmt"
+	"go-web/10-arch/settings"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"go.uber.org/zap"
+)
+
+const megabyte = 1024 * 1024
+
+// RotateEvent 一次日志文件切割
+type RotateEvent struct {
+	File   string    // 日志文件
+	Backup string    // 切割出来的旧文件，开启压缩时可能还没有压缩完
+	Reason string    // 切割的原因：size、interval
+	Time   time.Time // 切割的时间
+}
+
+var (
+	rotateMu    sync.Mutex
+	rotateHooks []func(RotateEvent)
+)
+
+// droppedRotations 事件队列满了时丢弃的切割事件数，重新初始化 logger 之后不清零
+var droppedRotations uint64
+
+// RotateStats 日志文件切割的统计
+type RotateStats struct {
+	DroppedEvents uint64 `json:"dropped_events" yaml:"dropped_events"` // 回调处理不过来时丢弃的切割事件数，这些切割没有执行 OnRotate 的回调
+}
+
+// RotationStats 返回日志文件切割的统计
+func RotationStats() RotateStats {
+	return RotateStats{DroppedEvents: atomic.LoadUint64(&droppedRotations)}
+}
+
+// OnRotate 注册日志文件切割之后的回调，例如上报监控或者把旧文件上传到对象存储
+// 回调在单独的 goroutine 中执行
+func OnRotate(fn func(RotateEvent)) {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	rotateHooks = append(rotateHooks, fn)
+}
+
+// rotator 在 lumberjack 的基础上增加按时间切割和所有文件总大小的限制
+// 按大小切割也由 rotator 负责，这样每次切割都能发出事件，lumberjack 只负责切割、压缩和按数量、天数清理旧文件
+type rotator struct {
+	mu       sync.Mutex
+	lj       *lumberjack.Logger
+	size     int64  // 当前文件的大小
+	maxSize  int64  // 单个文件的最大大小，0 表示不按大小切割
+	maxTotal int64  // 当前文件加上旧文件的总大小上限，0 表示不限制
+	interval string // hourly、daily，为空时不按时间切割
+	local    bool
+
+	events  chan RotateEvent
+	cleanup chan struct{} // 切割之后检查总大小，和事件分开，事件被丢弃时也会清理旧文件
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func getLogWriter(filename string, cfg *settings.LogConfig) *rotator {
+	r := &rotator{
+		lj: &lumberjack.Logger{
+			Filename: filename,
+			// 按大小切割由 rotator 自己判断，lumberjack 不再切割
+			MaxSize:    math.MaxInt32,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
+			LocalTime:  cfg.LocalTime,
+		},
+		maxSize:  int64(cfg.MaxSize) * megabyte,
+		maxTotal: int64(cfg.MaxTotalSize) * megabyte,
+		interval: cfg.Rotate,
+		local:    cfg.LocalTime,
+		events:   make(chan RotateEvent, 16),
+		cleanup:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	if info, err := os.Stat(filename); err == nil {
+		r.size = info.Size()
+		// 上一个周期留下来的文件先切割掉，保证每个文件只包含一个周期的日志
+		if r.interval != "" && r.size > 0 && info.ModTime().Before(r.periodStart(time.Now())) {
+			r.rotate("interval")
+		}
+	}
+	go r.run()
+	return r
+}
+
+func (r *rotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		r.rotate("size")
+	}
+	n, err := r.lj.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Sync lumberjack 没有缓冲，写入的内容已经在文件中了
+func (r *rotator) Sync() error {
+	return nil
+}
+
+// Close 停止定时切割并关闭文件
+func (r *rotator) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	return r.lj.Close()
+}
+
+// rotate 切割日志文件，调用方需要持有 r.mu
+// 这里不能用 zap 记录日志，日志最终也会写到 r 中，切割失败的信息只能输出到标准错误
+func (r *rotator) rotate(reason string) {
+	if err := r.lj.Rotate(); err != nil {
+		fmt.Fprintf(os.Stderr, "rotate log file %s failed: %v\n", r.lj.Filename, err)
+		return
+	}
+	r.size = 0
+	// 已经有一次清理在等着的时候不用再加，清理时会把所有的旧文件一起算上
+	select {
+	case r.cleanup <- struct{}{}:
+	default:
+	}
+	select {
+	case r.events <- RotateEvent{File: r.lj.Filename, Reason: reason, Time: time.Now()}:
+	default:
+		atomic.AddUint64(&droppedRotations, 1)
+	}
+}
+
+// run 按时间切割，并在切割之后清理旧文件、发出事件
+func (r *rotator) run() {
+	var tick <-chan time.Time
+	var timer *time.Timer
+	if r.interval != "" {
+		timer = time.NewTimer(time.Until(r.next(time.Now())))
+		defer timer.Stop()
+		tick = timer.C
+	}
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-tick:
+			r.mu.Lock()
+			if r.size > 0 {
+				r.rotate("interval")
+			}
+			r.mu.Unlock()
+			timer.Reset(time.Until(r.next(time.Now())))
+		case <-r.cleanup:
+			r.enforceTotal(r.backups())
+		case e := <-r.events:
+			// 最新的旧文件不会被 enforceTotal 删除
+			if backups := r.backups(); len(backups) > 0 {
+				e.Backup = backups[len(backups)-1].path
+			}
+			zap.L().Info("log file rotated",
+				zap.String("file", e.File),
+				zap.String("backup", e.Backup),
+				zap.String("reason", e.Reason),
+			)
+			rotateMu.Lock()
+			hooks := rotateHooks
+			rotateMu.Unlock()
+			for _, fn := range hooks {
+				fn(e)
+			}
+		}
+	}
+}
+
+// periodStart 返回 t 所在的切割周期的开始时间
+func (r *rotator) periodStart(t time.Time) time.Time {
+	if !r.local {
+		t = t.UTC()
+	}
+	y, m, d := t.Date()
+	if r.interval == "hourly" {
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// next 返回 t 之后的下一次切割时间，用 time.Date 计算以免夏令时切换的时候出错
+func (r *rotator) next(t time.Time) time.Time {
+	s := r.periodStart(t)
+	if r.interval == "hourly" {
+		return s.Add(time.Hour)
+	}
+	return time.Date(s.Year(), s.Month(), s.Day()+1, 0, 0, 0, 0, s.Location())
+}
+
+type backup struct {
+	path string
+	size int64
+}
+
+// backups 返回 lumberjack 切割出来的旧文件，按时间从旧到新排序
+// 旧文件的名字是 <name>-<时间><ext>，压缩之后再加上 .gz，时间的格式可以直接按字符串排序
+func (r *rotator) backups() []backup {
+	dir := filepath.Dir(r.lj.Filename)
+	base := filepath.Base(r.lj.Filename)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []backup
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if !strings.HasSuffix(name, ext) && !strings.HasSuffix(name, ext+".gz") {
+			continue
+		}
+		out = append(out, backup{path: filepath.Join(dir, name), size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
+
+// enforceTotal 当前文件和旧文件的总大小超过 max_total_size 时从最旧的文件开始删除
+// 最新的旧文件可能正在被 lumberjack 压缩，不会被删除
+func (r *rotator) enforceTotal(backups []backup) {
+	if r.maxTotal <= 0 || len(backups) < 2 {
+		return
+	}
+	r.mu.Lock()
+	total := r.size
+	r.mu.Unlock()
+	for _, b := range backups {
+		total += b.size
+	}
+	for _, b := range backups[:len(backups)-1] {
+		if total <= r.maxTotal {
+			return
+		}
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			zap.L().Warn("remove old log file failed", zap.String("file", b.path), zap.Error(err))
+			continue
+		}
+		total -= b.size
+	}
+}
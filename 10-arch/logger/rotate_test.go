@@ -0,0 +1,205 @@
+package logger
+
+import (
+	"bytes"
+	"go-web/10-arch/settings"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+)
+
+// chunk 600KB，按 1MB 切割时每两次写入切割一次
+var chunk = bytes.Repeat([]byte("x"), 600*1024)
+
+// waitFor 等 cond 成立，最多等 2s
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeChunks 写 n 次 chunk，旧文件的名字精确到毫秒，每次写之间稍微等一下以免重名
+func writeChunks(t *testing.T, r *rotator, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := r.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func totalSize(r *rotator) int64 {
+	r.mu.Lock()
+	total := r.size
+	r.mu.Unlock()
+	for _, b := range r.backups() {
+		total += b.size
+	}
+	return total
+}
+
+func TestRotateBySize(t *testing.T) {
+	tests := []struct {
+		maxSize     int // MB，0 表示不按大小切割
+		writes      int
+		wantBackups int
+	}{
+		{0, 4, 0},
+		{1, 1, 0},
+		{1, 2, 1},
+		{1, 5, 4},
+		{2, 5, 1},
+	}
+	for _, tt := range tests {
+		dir := tempDir(t)
+		r := getLogWriter(filepath.Join(dir, "app.log"), &settings.LogConfig{MaxSize: tt.maxSize})
+		writeChunks(t, r, tt.writes)
+		if got := len(r.backups()); got != tt.wantBackups {
+			t.Errorf("max_size %dMB, %d writes: %d backups, want %d", tt.maxSize, tt.writes, got, tt.wantBackups)
+		}
+		// 每个文件都不超过 max_size
+		for _, b := range r.backups() {
+			if tt.maxSize > 0 && b.size > int64(tt.maxSize)*megabyte {
+				t.Errorf("backup %s is %d bytes", b.path, b.size)
+			}
+		}
+		_ = r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRotatePeriod(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	at := time.Date(2024, 3, 31, 23, 40, 5, 0, loc)
+	tests := []struct {
+		interval  string
+		local     bool
+		wantStart time.Time
+		wantNext  time.Time
+	}{
+		{"hourly", true, time.Date(2024, 3, 31, 23, 0, 0, 0, loc), time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+		{"daily", true, time.Date(2024, 3, 31, 0, 0, 0, 0, loc), time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+		// 不使用本地时间时按 UTC 计算周期
+		{"hourly", false, time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 16, 0, 0, 0, time.UTC)},
+		{"daily", false, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		r := &rotator{interval: tt.interval, local: tt.local}
+		if got := r.periodStart(at); !got.Equal(tt.wantStart) {
+			t.Errorf("%s local=%v: periodStart = %v, want %v", tt.interval, tt.local, got, tt.wantStart)
+		}
+		if got := r.next(at); !got.Equal(tt.wantNext) {
+			t.Errorf("%s local=%v: next = %v, want %v", tt.interval, tt.local, got, tt.wantNext)
+		}
+	}
+}
+
+// 启动时上一个周期留下来的文件先切割掉
+func TestRotateStaleFileOnStart(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		interval    string
+		modTime     time.Time
+		content     string
+		wantBackups int
+	}{
+		{"daily", now.Add(-48 * time.Hour), "old\n", 1},
+		{"hourly", now.Add(-2 * time.Hour), "old\n", 1},
+		{"daily", now, "new\n", 0},
+		// 空文件不切割
+		{"daily", now.Add(-48 * time.Hour), "", 0},
+		// 不按时间切割
+		{"", now.Add(-48 * time.Hour), "old\n", 0},
+	}
+	for _, tt := range tests {
+		dir := tempDir(t)
+		name := filepath.Join(dir, "app.log")
+		if err := ioutil.WriteFile(name, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, tt.modTime, tt.modTime); err != nil {
+			t.Fatal(err)
+		}
+		r := getLogWriter(name, &settings.LogConfig{Rotate: tt.interval, LocalTime: true})
+		backups := r.backups()
+		if len(backups) != tt.wantBackups {
+			t.Errorf("%q modified %v ago: %d backups, want %d", tt.interval, now.Sub(tt.modTime), len(backups), tt.wantBackups)
+		} else if len(backups) == 1 {
+			if b, _ := ioutil.ReadFile(backups[0].path); string(b) != tt.content {
+				t.Errorf("backup content %q, want %q", b, tt.content)
+			}
+		}
+		_ = r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRotateTotalSize(t *testing.T) {
+	tests := []struct {
+		maxTotal int // MB
+		writes   int
+	}{
+		{2, 8},
+		{3, 10},
+	}
+	for _, tt := range tests {
+		dir := tempDir(t)
+		r := getLogWriter(filepath.Join(dir, "app.log"), &settings.LogConfig{MaxSize: 1, MaxTotalSize: tt.maxTotal})
+		writeChunks(t, r, tt.writes)
+		limit := int64(tt.maxTotal) * megabyte
+		waitFor(t, "old files to be removed", func() bool { return totalSize(r) <= limit })
+		// 最新的旧文件始终保留
+		if len(r.backups()) == 0 {
+			t.Errorf("max_total_size %dMB: all backups were removed", tt.maxTotal)
+		}
+		_ = r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// 事件队列满了的时候丢弃的事件会被计数，总大小的限制照样生效
+func TestRotateDroppedEvents(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// 先不启动 run，模拟回调处理不过来，事件队列只有一个位置
+	r := &rotator{
+		lj:       &lumberjack.Logger{Filename: filepath.Join(dir, "app.log"), MaxSize: math.MaxInt32},
+		maxSize:  megabyte,
+		maxTotal: 2 * megabyte,
+		events:   make(chan RotateEvent, 1),
+		cleanup:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	defer r.Close()
+
+	before := RotationStats().DroppedEvents
+	writeChunks(t, r, 8) // 切割 7 次
+	if got := RotationStats().DroppedEvents - before; got != 6 {
+		t.Errorf("dropped %d events, want 6", got)
+	}
+	if n := len(r.backups()); n != 7 {
+		t.Fatalf("%d backups, want 7", n)
+	}
+
+	go r.run()
+	waitFor(t, "old files to be removed", func() bool { return totalSize(r) <= 2*megabyte })
+}
@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"go-web/10-arch/settings"
+	"path/filepath"
+	"strings"
+)
+
+// sinks 返回需要创建的日志输出，没有配置 log.sinks 时按 mode 返回默认的输出：
+// dev 模式在终端输出便于阅读的 console 格式，同时写 JSON 日志文件
+// 其他模式只写 JSON 日志文件
+// 默认的输出中 error 及以上级别的日志还会单独写一份到 *.error.log，方便排查问题
+func sinks(cfg *settings.LogConfig, mode string) []settings.SinkConfig {
+	out := cfg.Sinks
+	if len(out) == 0 {
+		if mode == "dev" {
+			out = append(out, settings.SinkConfig{Encoder: "console", Output: "stdout"})
+		}
+		out = append(out,
+			settings.SinkConfig{Encoder: "json", Output: "file"},
+			settings.SinkConfig{Encoder: "json", Output: "file", Level: "error", Filename: errorFilename(cfg.Filename)},
+		)
+	}
+
+	// 没有指定文件的输出使用 log.filename，不修改配置中的切片
+	res := make([]settings.SinkConfig, len(out))
+	copy(res, out)
+	for i := range res {
+		if res[i].Output == "file" && res[i].Filename == "" {
+			res[i].Filename = cfg.Filename
+		}
+	}
+	return res
+}
+
+// errorFilename 错误日志的文件名，例如 logs/web_app.log -> logs/web_app.error.log
+func errorFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + ".error" + ext
+}
@@ -1,3 +1,25 @@
 package logic
 
 // 存放业务逻辑
+
+import (
+	"context"
+	"go-web/10-arch/dao/mysql"
+	"go-web/10-arch/logger"
+
+	"go.uber.org/zap"
+)
+
+// Health 检查服务依赖的组件是否可用，返回每个组件的状态
+func Health(ctx context.Context) (map[string]string, bool) {
+	status := map[string]string{"mysql": "ok"}
+	healthy := true
+	if err := mysql.Ping(ctx); err != nil {
+		status["mysql"] = "unavailable"
+		healthy = false
+	}
+	if !healthy {
+		logger.FromContext(ctx).Warn("health check failed", zap.Any("status", status))
+	}
+	return status, healthy
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"go-web/10-arch/controllers"
 	"go-web/10-arch/dao/mysql"
 	"go-web/10-arch/logger"
 	"go-web/10-arch/routes"
@@ -18,17 +19,36 @@ import (
 // go 开发比较通用的脚手架
 
 func main() {
+	// 配置相关的子命令：web_app config sample|schema|check <file>
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := settings.Command(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 1、加载配置文件
-	if err := settings.Init(); err != nil {
+	if err := settings.Init(os.Args[1:]); err != nil {
+		if err == settings.ErrHelp {
+			return
+		}
+		// 配置有问题的时候不启动服务
 		fmt.Println("Init settings failed, err:",err)
+		os.Exit(1)
 	}
+	conf := settings.Current()
 	// 2、初始化日志
-	if err := logger.Init(settings.Conf.LogConfig); err != nil {
+	if err := logger.Init(conf.LogConfig, conf.Mode); err != nil {
 		fmt.Println("Init logger failed, err:",err)
 	}
-	defer zap.L().Sync()
+	defer logger.Sync()
+	zap.L().Info("config loaded",
+		zap.String("mode", conf.Mode),
+		zap.Strings("files", settings.ConfigFiles()),
+	)
 	// 3、初始化mysql
-	if err := mysql.Init(settings.Conf.MySQLConfig); err != nil {
+	if err := mysql.Init(conf.MySQLConfig); err != nil {
 		fmt.Println("Init logger failed, err:",err)
 	}
 	defer mysql.Close()
@@ -40,9 +60,11 @@ func main() {
 
 	// 6、启动服务（优雅关机）
 	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", settings.Conf.Port),
+		Addr:              fmt.Sprintf(":%d", conf.Port),
 		Handler:           r,
 	}
+	// 关机时断开实时查看日志的长连接，否则 Shutdown 会一直等到超时
+	srv.RegisterOnShutdown(controllers.CloseStreams)
 
 	go func() {
 		// 开启一个 goroutine 启动服务
@@ -51,10 +73,23 @@ func main() {
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)		// 创建一个接收信号的通道
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)		// 这里不会阻塞
-	<- quit		// 在这里阻塞，当接收到上面两种信号的时候才会往下进行
+	quit := make(chan os.Signal, 1) // 创建一个接收信号的通道
+	// reopenSignals 用来在 logrotate 切割之后重新打开日志文件，见 signal_unix.go
+	signal.Notify(quit, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, reopenSignals...)...) // 这里不会阻塞
+	// 在这里阻塞，当接收到 SIGINT 或者 SIGTERM 的时候才会往下进行
+	for sig := range quit {
+		if !isReopenSignal(sig) {
+			break
+		}
+		if err := logger.Reopen(); err != nil {
+			zap.L().Error("reopen log files failed", zap.Error(err))
+			continue
+		}
+		zap.L().Info("log files reopened")
+	}
 	zap.L().Info("shutdown server ...")
+	// 退出的过程中不再热加载配置
+	settings.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel( )
 
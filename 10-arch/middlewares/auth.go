@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"go-web/10-arch/settings"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryTokenRoutes 可以用 ?token=<admin.token> 鉴权的接口
+// 浏览器的 EventSource 不能设置请求头，只有给它用的接口才放开，其他接口的 token 不会出现在 URL 中
+var queryTokenRoutes = map[string]bool{
+	"/admin/logs/tail": true,
+}
+
+// AdminAuth 管理接口的鉴权，请求头中需要带上 Authorization: Bearer <admin.token>
+// queryTokenRoutes 中的接口也可以用 ?token=<admin.token>，访问日志中 token 参数默认会脱敏
+// 没有配置 admin.token 的时候管理接口不对外开放
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var token string
+		if cfg := settings.Current().AdminConfig; cfg != nil {
+			token = cfg.Token.Value()
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "admin api is disabled"})
+			return
+		}
+
+		var given string
+		if queryTokenRoutes[c.FullPath()] {
+			given = c.Query("token")
+		}
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
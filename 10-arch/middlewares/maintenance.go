@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"go-web/10-arch/settings"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance 开启维护模式之后，除了管理接口之外的请求都直接返回 503
+func Maintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if settings.Current().Maintenance && !strings.HasPrefix(c.Request.URL.Path, "/admin/") {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"msg": "service under maintenance"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-web/10-arch/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader 请求 ID 使用的请求头和响应头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID 为每个请求分配一个 ID，上游已经带了合法的 X-Request-ID 时沿用上游的
+// 请求 ID 会写到响应头中，并且创建一个带 request_id 字段的 logger 保存到 gin.Context 和请求的 context.Context 中，
+// handler、logic、dao 中通过 logger.FromContext(ctx) 取出来记录日志，同一个请求的日志就能串起来
+// 需要放在 GinLogger 之前
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		logger.WithGin(c, zap.L().With(zap.String("request_id", id)))
+		c.Next()
+	}
+}
+
+// validRequestID 只接受长度有限的字母、数字和 -_.，避免上游传入的值污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
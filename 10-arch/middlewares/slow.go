@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"go-web/10-arch/logger"
+	"go-web/10-arch/pkg/timing"
+	"go-web/10-arch/settings"
+	"go-web/ginzap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SlowRequest 一个超过阈值的请求，耗时都是 time.Duration 的字符串形式，方便直接查看
+type SlowRequest struct {
+	Time       time.Time `json:"time" yaml:"time"`
+	RequestID  string    `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	Method     string    `json:"method" yaml:"method"`
+	Path       string    `json:"path" yaml:"path"`
+	Route      string    `json:"route,omitempty" yaml:"route,omitempty"`
+	Status     int       `json:"status" yaml:"status"`
+	Threshold  string    `json:"threshold" yaml:"threshold"`
+	Total      string    `json:"total" yaml:"total"`
+	Middleware string    `json:"middleware" yaml:"middleware"`
+	Handler    string    `json:"handler" yaml:"handler"`
+	DB         string    `json:"db" yaml:"db"`
+	DBCalls    int       `json:"db_calls" yaml:"db_calls"`
+
+	cost time.Duration
+}
+
+// slowList 最近的慢请求，最多保留 http.slow.keep 个
+var slowList struct {
+	sync.Mutex
+	items []SlowRequest
+}
+
+// SlowRequests 返回最近的慢请求，按耗时从高到低排序
+func SlowRequests() []SlowRequest {
+	slowList.Lock()
+	out := append([]SlowRequest{}, slowList.items...)
+	slowList.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].cost > out[j].cost })
+	return out
+}
+
+func recordSlow(r SlowRequest, keep int) {
+	slowList.Lock()
+	defer slowList.Unlock()
+	slowList.items = append(slowList.items, r)
+	if n := len(slowList.items) - keep; n > 0 {
+		slowList.items = append(slowList.items[:0:0], slowList.items[n:]...)
+	}
+}
+
+// Slow 检测慢请求，耗时超过 http.slow 配置的阈值时记录一条 warn 日志，包括中间件、handler、数据库各自的耗时
+// 需要放在 RequestID 之后、其他中间件之前，handler 的耗时需要配合 HandlerTiming 统计
+func Slow() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := timing.New()
+		c.Request = c.Request.WithContext(timing.NewContext(c.Request.Context(), t))
+		c.Next()
+
+		cfg := settings.Current().HTTPConfig
+		if cfg == nil {
+			return
+		}
+		// SSE 这样的长连接耗时取决于客户端，不算慢请求
+		if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		threshold := slowThreshold(c, cfg.Slow)
+		b := t.Breakdown()
+		if threshold <= 0 || b.Total < threshold {
+			return
+		}
+
+		logger.FromContext(c).Warn("slow request",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("threshold", threshold),
+			zap.Duration("total", b.Total),
+			zap.Duration("middleware", b.Middleware),
+			zap.Duration("handler", b.Handler),
+			zap.Duration("db", b.DB),
+			zap.Int("db_calls", b.DBCalls),
+		)
+		if cfg.Slow.Keep > 0 {
+			recordSlow(SlowRequest{
+				Time:       time.Now(),
+				RequestID:  c.Writer.Header().Get(RequestIDHeader),
+				Method:     c.Request.Method,
+				Path:       c.Request.URL.Path,
+				Route:      c.FullPath(),
+				Status:     c.Writer.Status(),
+				Threshold:  threshold.String(),
+				Total:      b.Total.String(),
+				Middleware: b.Middleware.String(),
+				Handler:    b.Handler.String(),
+				DB:         b.DB.String(),
+				DBCalls:    b.DBCalls,
+				cost:       b.Total,
+			}, cfg.Slow.Keep)
+		}
+	}
+}
+
+// slowThreshold 返回请求的阈值，routes 中第一个匹配的规则优先
+func slowThreshold(c *gin.Context, cfg settings.SlowConfig) time.Duration {
+	for _, r := range cfg.Routes {
+		if ginzap.MatchRoute(r.Route, c) {
+			return r.Threshold
+		}
+	}
+	return cfg.Threshold
+}
+
+// HandlerTiming 标记 handler 开始和结束的时间，放在所有中间件的最后
+// 路由分组额外添加了中间件时，在分组的中间件之后再加一次，以最里面的一次为准
+func HandlerTiming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := timing.FromContext(c.Request.Context())
+		t.HandlerStart()
+		c.Next()
+		t.HandlerEnd()
+	}
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Dedup 按 Fingerprint 去重、限流之后交给 next 发送
+// 同一个指纹在 interval 内只发送第一次，之后的重复只计数，周期结束时有重复的话发送一条 digest 并开始新的周期
+// 通知在后台的 goroutine 中发送，队列满了时丢弃，不会阻塞调用方
+type Dedup struct {
+	next     Notifier
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*window
+	closed  bool
+
+	queue   chan Event
+	dropped uint64
+	done    chan struct{}
+}
+
+// window 一个指纹当前的限流周期
+type window struct {
+	event      Event // 周期内第一次出现时的通知，digest 沿用它的内容
+	suppressed int
+	first      time.Time
+	last       time.Time
+	timer      *time.Timer
+}
+
+// NewDedup 创建一个 Dedup，timeout 为每次发送的超时时间
+func NewDedup(next Notifier, interval, timeout time.Duration, queueSize int) *Dedup {
+	d := &Dedup{
+		next:     next,
+		interval: interval,
+		timeout:  timeout,
+		windows:  make(map[string]*window),
+		queue:    make(chan Event, queueSize),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Notify 按指纹判断是否需要发送，需要的话放到队列中，始终返回 nil
+func (d *Dedup) Notify(_ context.Context, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	if w, ok := d.windows[e.Fingerprint]; ok {
+		if w.suppressed == 0 {
+			w.first = e.Time
+		}
+		w.suppressed++
+		w.last = e.Time
+		return nil
+	}
+	w := &window{event: e}
+	fp := e.Fingerprint
+	w.timer = time.AfterFunc(d.interval, func() { d.expire(fp) })
+	d.windows[fp] = w
+	d.enqueue(e)
+	return nil
+}
+
+// Dropped 返回因为队列满了丢弃的通知数
+func (d *Dedup) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// expire 周期结束，有被忽略的重复时发送 digest 并开始新的周期，否则删除这个指纹
+func (d *Dedup) expire(fp string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, ok := d.windows[fp]
+	if !ok || d.closed {
+		return
+	}
+	if w.suppressed == 0 {
+		delete(d.windows, fp)
+		return
+	}
+	d.enqueue(w.digest())
+	w.suppressed = 0
+	w.timer.Reset(d.interval)
+}
+
+func (w *window) digest() Event {
+	e := w.event
+	e.Kind = KindDigest
+	e.Time = time.Now()
+	e.Count, e.First, e.Last = w.suppressed, w.first, w.last
+	return e
+}
+
+// enqueue 调用方需要持有 d.mu
+func (d *Dedup) enqueue(e Event) {
+	select {
+	case d.queue <- e:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+	}
+}
+
+// Close 把还没结束的周期中被忽略的重复汇总发送出去，等队列中的通知发送完之后返回
+func (d *Dedup) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		<-d.done
+		return nil
+	}
+	for _, w := range d.windows {
+		w.timer.Stop()
+		if w.suppressed > 0 {
+			d.enqueue(w.digest())
+		}
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+	<-d.done
+	return nil
+}
+
+func (d *Dedup) run() {
+	defer close(d.done)
+	for e := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err := d.next.Notify(ctx, e)
+		cancel()
+		if err != nil {
+			// 发送失败只记录 warn，避免 error 日志再触发通知
+			zap.L().Named("notify").Warn("send notification failed",
+				zap.String("kind", e.Kind),
+				zap.String("fingerprint", e.Fingerprint),
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// wait 等 webhook 收到 n 个请求
+func (s *server) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d notifications, want %d", i, n)
+		}
+	}
+}
+
+func notifyAt(d *Dedup, fp string, t time.Time) {
+	_ = d.Notify(context.Background(), Event{Kind: KindError, Message: "db down", Fingerprint: fp, Time: t})
+}
+
+func TestDedupSuppressesRepeats(t *testing.T) {
+	s := newServer(http.StatusOK)
+	defer s.Close()
+	d := NewDedup(NewWebhook(s.URL, nil, time.Second), time.Hour, time.Second, 16)
+	defer d.Close()
+
+	now := time.Now()
+	notifyAt(d, "a", now)
+	notifyAt(d, "a", now.Add(time.Second))
+	notifyAt(d, "b", now)
+	s.wait(t, 2)
+	// 周期还没结束，重复的通知只计数
+	time.Sleep(50 * time.Millisecond)
+	if events := s.events(); len(events) != 2 || events[0].Fingerprint != "a" || events[1].Fingerprint != "b" {
+		t.Fatalf("unexpected notifications: %+v", events)
+	}
+}
+
+func TestDedupDigest(t *testing.T) {
+	s := newServer(http.StatusOK)
+	defer s.Close()
+	d := NewDedup(NewWebhook(s.URL, nil, time.Second), 100*time.Millisecond, time.Second, 16)
+	defer d.Close()
+
+	start := time.Now().Truncate(time.Second)
+	for i := 0; i < 4; i++ {
+		notifyAt(d, "a", start.Add(time.Duration(i)*time.Second))
+	}
+	// 第一次的通知和周期结束时的 digest
+	s.wait(t, 2)
+	events := s.events()
+	e := events[1]
+	if e.Kind != KindDigest || e.Count != 3 || e.Message != "db down" {
+		t.Fatalf("unexpected digest: %+v", e)
+	}
+	if !e.First.Equal(start.Add(time.Second)) || !e.Last.Equal(start.Add(3*time.Second)) {
+		t.Fatalf("digest first/last = %v/%v", e.First, e.Last)
+	}
+
+	// 没有重复的周期结束之后指纹被删除，再次出现时重新通知
+	time.Sleep(300 * time.Millisecond)
+	notifyAt(d, "a", time.Now())
+	s.wait(t, 1)
+	if e := s.events()[2]; e.Kind != KindError {
+		t.Fatalf("expected a new notification, got %+v", e)
+	}
+}
+
+func TestDedupCloseFlushesDigests(t *testing.T) {
+	s := newServer(http.StatusOK)
+	defer s.Close()
+	d := NewDedup(NewWebhook(s.URL, nil, time.Second), time.Hour, time.Second, 16)
+
+	now := time.Now()
+	notifyAt(d, "a", now)
+	notifyAt(d, "a", now)
+	notifyAt(d, "b", now)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := s.events()
+	if len(events) != 3 || events[2].Kind != KindDigest || events[2].Fingerprint != "a" || events[2].Count != 1 {
+		t.Fatalf("unexpected notifications: %+v", events)
+	}
+	// 关闭之后的通知被忽略
+	notifyAt(d, "c", now)
+	if err := d.Close(); err != nil || len(s.events()) != 3 {
+		t.Fatal("notified after Close")
+	}
+}
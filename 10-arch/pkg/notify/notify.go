@@ -0,0 +1,66 @@
+// Package notify 在出现 panic 或者 error 日志的时候通知相关的人
+// Notifier 负责发送，Dedup 按指纹去重和限流，相同的问题在一个周期内只通知一次，周期结束时汇总被忽略的次数
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 通知的类型
+const (
+	KindPanic  = "panic"
+	KindError  = "error"
+	KindDigest = "digest" // 一个周期内被忽略的重复通知的汇总
+)
+
+// Event 一次通知的内容
+type Event struct {
+	Kind        string                 `json:"kind"`
+	Service     string                 `json:"service,omitempty"`
+	Level       string                 `json:"level,omitempty"`
+	Logger      string                 `json:"logger,omitempty"`
+	Caller      string                 `json:"caller,omitempty"`
+	Message     string                 `json:"message"`
+	RequestID   string                 `json:"request_id,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	Fingerprint string                 `json:"fingerprint"`
+	Time        time.Time              `json:"time"`
+
+	// 只有 digest 才有，Count 为周期内被忽略的次数，First、Last 为第一次和最后一次出现的时间
+	Count int       `json:"count,omitempty"`
+	First time.Time `json:"first,omitempty"`
+	Last  time.Time `json:"last,omitempty"`
+}
+
+// Notifier 发送通知，例如 Webhook
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+var (
+	goroutineLine = regexp.MustCompile(`(?m)^goroutine \d+ \[[^\]]*\]:\n`)
+	createdIn     = regexp.MustCompile(` in goroutine \d+`)
+	pcOffset      = regexp.MustCompile(` \+0x[0-9a-f]+`)
+	callArgs      = regexp.MustCompile(`(?m)\([^()\n]*\)$`) // 函数调用行最后的参数列表
+)
+
+// Fingerprint 计算用来去重的指纹，stack 中的 goroutine 编号、参数和 PC 偏移会被去掉，同一个位置的问题指纹相同
+func Fingerprint(stack string, parts ...string) string {
+	stack = goroutineLine.ReplaceAllString(stack, "")
+	stack = createdIn.ReplaceAllString(stack, "")
+	stack = pcOffset.ReplaceAllString(stack, "")
+	stack = callArgs.ReplaceAllString(stack, "(...)")
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(strings.TrimSpace(stack)))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 签名相关的请求头
+// 接收方用同一个 secret 对 "<X-Notify-Timestamp>.<请求体>" 计算 HMAC-SHA256，和 X-Notify-Signature 比较
+const (
+	SignatureHeader = "X-Notify-Signature" // sha256=<hex>
+	TimestampHeader = "X-Notify-Timestamp" // Unix 秒，接收方可以拒绝时间相差太多的请求，防止重放
+)
+
+// Webhook 把通知以 JSON POST 到 URL，配置了 Secret 时带上签名
+type Webhook struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+// NewWebhook 创建一个 Webhook，timeout 为每次请求的超时时间
+func NewWebhook(url string, secret []byte, timeout time.Duration) *Webhook {
+	return &Webhook{URL: url, Secret: secret, Client: &http.Client{Timeout: timeout}}
+}
+
+// Notify 发送通知，返回非 2xx 的状态码时返回错误
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.Secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, ts, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign 计算签名，接收方可以用它校验请求
+func Sign(secret []byte, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
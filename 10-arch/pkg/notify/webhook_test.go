@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request webhook 收到的一次请求
+type request struct {
+	header http.Header
+	body   []byte
+	event  Event
+}
+
+// server 记录收到的请求，每次请求都返回 status
+type server struct {
+	*httptest.Server
+	status int
+
+	mu       sync.Mutex
+	requests []request
+	received chan struct{}
+}
+
+func newServer(status int) *server {
+	s := &server{status: status, received: make(chan struct{}, 100)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := request{header: r.Header, body: body}
+		_ = json.Unmarshal(body, &req.event)
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		w.WriteHeader(s.status)
+		s.received <- struct{}{}
+	}))
+	return s
+}
+
+func (s *server) events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Event
+	for _, r := range s.requests {
+		out = append(out, r.event)
+	}
+	return out
+}
+
+func TestSign(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"kind":"panic"}`)
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("1700000000." + string(body)))
+	if got, want := Sign(secret, "1700000000", body), hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	if Sign(secret, "1700000001", body) == Sign(secret, "1700000000", body) {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
+
+func TestWebhookSignsRequests(t *testing.T) {
+	s := newServer(http.StatusOK)
+	defer s.Close()
+	secret := []byte("s3cret")
+	w := NewWebhook(s.URL, secret, time.Second)
+	if err := w.Notify(context.Background(), Event{Kind: KindPanic, Message: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.requests[0]
+	if r.event.Message != "boom" || r.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	ts := r.header.Get(TimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("bad %s %q: %v", TimestampHeader, ts, err)
+	}
+	if d := time.Since(time.Unix(sec, 0)); d < -time.Second || d > 5*time.Second {
+		t.Fatalf("%s is %v away from now", TimestampHeader, d)
+	}
+	if got, want := r.header.Get(SignatureHeader), "sha256="+Sign(secret, ts, r.body); got != want {
+		t.Fatalf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+}
+
+func TestWebhookWithoutSecret(t *testing.T) {
+	s := newServer(http.StatusNoContent)
+	defer s.Close()
+	if err := NewWebhook(s.URL, nil, time.Second).Notify(context.Background(), Event{Kind: KindError}); err != nil {
+		t.Fatal(err)
+	}
+	if h := s.requests[0].header; h.Get(SignatureHeader) != "" || h.Get(TimestampHeader) != "" {
+		t.Fatalf("unsigned webhook sent signature headers: %v", h)
+	}
+}
+
+func TestWebhookNon2xx(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusBadRequest, http.StatusInternalServerError} {
+		s := newServer(status)
+		err := NewWebhook(s.URL, nil, time.Second).Notify(context.Background(), Event{Kind: KindError})
+		s.Close()
+		if err == nil {
+			t.Errorf("status %d: expected an error", status)
+		}
+	}
+}
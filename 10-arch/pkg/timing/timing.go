@@ -0,0 +1,97 @@
+// Package timing 记录一个请求的耗时分布：中间件、handler 以及其中访问数据库的时间
+// 请求开始时用 NewContext 放到 context.Context 中，DAO 层通过 AddDB 累加访问数据库的时间
+package timing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timing 一个请求的耗时分布
+type Timing struct {
+	mu           sync.Mutex
+	start        time.Time
+	handlerStart time.Time
+	handlerEnd   time.Time
+	db           time.Duration
+	dbCalls      int
+}
+
+// Breakdown 请求结束之后的耗时分布
+type Breakdown struct {
+	Total      time.Duration
+	Middleware time.Duration // 中间件的耗时，Total 减去 handler 的耗时
+	Handler    time.Duration // handler 自己的耗时，不包括 DB
+	DB         time.Duration
+	DBCalls    int
+}
+
+type ctxKey struct{}
+
+// New 创建一个从现在开始计时的 Timing
+func New() *Timing {
+	return &Timing{start: time.Now()}
+}
+
+// NewContext 把 t 保存到 ctx 中
+func NewContext(ctx context.Context, t *Timing) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext 返回 ctx 中的 Timing，没有时返回 nil，nil 的 Timing 上调用方法不会做任何事情
+func FromContext(ctx context.Context) *Timing {
+	t, _ := ctx.Value(ctxKey{}).(*Timing)
+	return t
+}
+
+// AddDB 累加一次访问数据库的耗时
+func AddDB(ctx context.Context, d time.Duration) {
+	if t := FromContext(ctx); t != nil {
+		t.mu.Lock()
+		t.db += d
+		t.dbCalls++
+		t.mu.Unlock()
+	}
+}
+
+// HandlerStart 记录 handler 开始执行的时间，多次调用时以最后一次为准
+func (t *Timing) HandlerStart() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.handlerStart = time.Now()
+	t.handlerEnd = time.Time{}
+	t.mu.Unlock()
+}
+
+// HandlerEnd 记录 handler 执行结束的时间，多次调用时以第一次为准
+func (t *Timing) HandlerEnd() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.handlerEnd.IsZero() {
+		t.handlerEnd = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+// Breakdown 计算到现在为止的耗时分布，请求被中间件拦截没有执行 handler 时全部算作中间件的耗时
+func (t *Timing) Breakdown() Breakdown {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := Breakdown{Total: time.Since(t.start), DB: t.db, DBCalls: t.dbCalls}
+	if !t.handlerStart.IsZero() && !t.handlerEnd.IsZero() {
+		b.Handler = t.handlerEnd.Sub(t.handlerStart) - t.db
+		if b.Handler < 0 {
+			b.Handler = 0
+		}
+	}
+	b.Middleware = b.Total - b.Handler - b.DB
+	if b.Middleware < 0 {
+		b.Middleware = 0
+	}
+	return b
+}
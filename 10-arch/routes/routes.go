@@ -2,16 +2,33 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"go-web/10-arch/controllers"
 	"go-web/10-arch/logger"
+	"go-web/10-arch/middlewares"
 	"net/http"
 )
 
 func Setup() *gin.Engine {
 	r := gin.New()
-	r.Use(logger.GinLogger(), logger.GinRecovery(true))
+	r.Use(middlewares.RequestID(), middlewares.Slow(), logger.GinLogger(), logger.GinRecovery(true), middlewares.Maintenance(), middlewares.HandlerTiming())
 
 	r.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "hello")
 	})
+	r.GET("/health", controllers.HealthHandler)
+
+	// 管理接口，需要 admin.token 鉴权
+	admin := r.Group("/admin", middlewares.AdminAuth(), middlewares.HandlerTiming())
+	{
+		admin.GET("/config", controllers.AdminConfigHandler)
+		admin.GET("/config/overrides", controllers.AdminOverridesHandler)
+		admin.PUT("/config/overrides", controllers.AdminSetOverridesHandler)
+		admin.GET("/log/level", controllers.AdminLogLevelHandler)
+		admin.PUT("/log/level", controllers.AdminSetLogLevelHandler)
+		admin.GET("/log/stats", controllers.AdminLogStatsHandler)
+		admin.GET("/logs", controllers.AdminLogsHandler)
+		admin.GET("/logs/tail", controllers.AdminLogsTailHandler)
+		admin.GET("/slow", controllers.AdminSlowHandler)
+	}
 	return r
 }
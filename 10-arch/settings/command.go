@@ -0,0 +1,303 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// commandUsage config 子命令的帮助信息
+const commandUsage = `Usage: web_app config <command>
+
+Commands:
+  sample          输出带注释和默认值的示例配置文件
+  schema          输出配置文件的 JSON Schema
+  check <file> [flags]
+                  按启动时的方式加载并校验配置文件，flags 和启动参数相同，例如 --mode prod
+                  config.<mode>.yaml 会叠加在 config.yaml 上校验
+  genkey          生成加密配置用的密钥
+  encrypt [value] 加密一个配置值，不传 value 时从标准输入读取
+  decrypt <value> 解密一个 ENC[...] 配置值
+  rotate <file> --new-key-file <path>
+                  把文件中所有加密的值换成新的密钥重新加密
+
+加解密使用的密钥从环境变量 ` + keyEnv + ` 或者 ` + keyFileEnv + ` 指定的文件中读取`
+
+// Command 执行 config 子命令，args 为 config 之后的参数，结果输出到 out
+func Command(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(commandUsage)
+	}
+	switch args[0] {
+	case "sample":
+		_, err := io.WriteString(out, Sample())
+		return err
+	case "schema":
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(JSONSchema())
+	case "check":
+		if len(args) < 2 {
+			return errors.New(commandUsage)
+		}
+		if err := CheckFile(args[1], args[2:]); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(out, "%s: ok\n", args[1])
+		return err
+	case "genkey":
+		key, err := GenerateKey()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, key)
+		return err
+	case "encrypt":
+		return encryptCommand(args[1:], out)
+	case "decrypt":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		key, err := LoadKey()
+		if err != nil {
+			return err
+		}
+		plain, err := Decrypt(key, args[1])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, plain)
+		return err
+	case "rotate":
+		return rotateCommand(args[1:], out)
+	case "-h", "--help", "help":
+		_, err := fmt.Fprintln(out, commandUsage)
+		return err
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], commandUsage)
+}
+
+// encryptCommand 加密命令行参数或者标准输入中的值
+// 从标准输入读取可以避免明文留在 shell 的历史记录中
+func encryptCommand(args []string, out io.Writer) error {
+	key, err := LoadKey()
+	if err != nil {
+		return err
+	}
+	var plain string
+	switch len(args) {
+	case 0:
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		plain = strings.TrimRight(string(b), "\r\n")
+	case 1:
+		plain = args[0]
+	default:
+		return errors.New(commandUsage)
+	}
+	enc, err := Encrypt(key, plain)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, enc)
+	return err
+}
+
+// rotateCommand 把配置文件中的加密值换成新的密钥，旧密钥从环境变量中读取
+func rotateCommand(args []string, out io.Writer) error {
+	fs := pflag.NewFlagSet("rotate", pflag.ContinueOnError)
+	newKeyFile := fs.String("new-key-file", "", "保存新密钥的文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *newKeyFile == "" {
+		return errors.New(commandUsage)
+	}
+	path := fs.Arg(0)
+
+	oldKey, err := LoadKey()
+	if err != nil {
+		return err
+	}
+	newKey, err := ReadKeyFile(*newKeyFile)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rotated, n, err := RotateKey(data, oldKey, newKey)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := writeFileAtomic(path, rotated, info.Mode().Perm()); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s: %d values re-encrypted\n", path, n)
+	return err
+}
+
+// CheckFile 按启动时同样的方式加载配置并校验，检查通过的配置启动时也能通过
+// 配置文件链中的每个文件先用 JSON Schema 校验类型和取值，再合并上默认值、环境变量和命令行参数 args（例如 --mode prod），
+// 以及持久化下来的运行时配置，最后执行启动时的 validate；远程配置中心不会连接
+// path 是 config.prod.yaml 这样的 profile 文件、并且 config.yaml 存在时，叠加在 config.yaml 上校验，mode 默认为 prod
+// 会修改全局的 viper，只能在 config 子命令中使用，不能在服务运行的时候调用
+func CheckFile(path string, args []string) error {
+	fs := newFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	base := path
+	if b, profile, ok := splitProfile(path); ok {
+		base = b
+		if profile != localProfile && !fs.Changed("mode") {
+			_ = fs.Set("mode", profile)
+		}
+	}
+
+	viper.SetConfigFile(base)
+	setDefaults()
+	bindEnvs()
+	if err := bindFlags(fs); err != nil {
+		return err
+	}
+	flags = fs
+
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	files := []string{base}
+	for _, p := range profileFiles(base, viper.GetString("mode")) {
+		if _, err := os.Stat(p); err == nil {
+			files = append(files, p)
+		}
+	}
+	schema := fileSchema()
+	for _, f := range files {
+		v, err := readFile(f)
+		if err != nil {
+			return err
+		}
+		if err := schema.Check(v.AllSettings()); err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+	}
+
+	s, _, err := load(nil)
+	if err != nil {
+		return err
+	}
+	if path := overridesFile(s.conf); path != "" {
+		ov, err := readOverrides(path)
+		if err != nil {
+			return err
+		}
+		_, _, err = load(ov)
+		return err
+	}
+	return nil
+}
+
+// splitProfile 把 config.prod.yaml 拆成基础配置文件 config.yaml 和 profile prod，基础配置文件不存在时返回 false
+func splitProfile(path string) (base, profile string, ok bool) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	i := strings.LastIndex(stem, ".")
+	if i <= 0 || strings.ContainsAny(stem[i:], `/\`) {
+		return "", "", false
+	}
+	base, profile = stem[:i]+ext, stem[i+1:]
+	if info, err := os.Stat(base); err != nil || info.IsDir() || profile == "" {
+		return "", "", false
+	}
+	return base, profile, true
+}
+
+// placeholders 示例配置中必填项的示例值，这样生成的示例配置可以直接通过 check，使用前需要改成实际的值
+var placeholders = map[string]interface{}{
+	"name":         "web_app",
+	"mysql.host":   "127.0.0.1",
+	"mysql.port":   3306,
+	"mysql.user":   "root",
+	"mysql.dbname": "web_app",
+}
+
+// Sample 通过反射 AppConfig 生成示例配置文件，每个配置项上面都带有说明和对应的环境变量
+// 有默认值的配置项填的是默认值，必填项填的是 placeholders 中的示例值，否则是零值
+func Sample() string {
+	var b strings.Builder
+	b.WriteString("# web_app 示例配置，由 `web_app config sample` 生成\n")
+	b.WriteString("# 配置项可以用对应的 WEBAPP_ 环境变量覆盖，字符串中可以使用 ${env:NAME}、${file:/path} 引用\n")
+
+	var open []string // 上一个配置项所在的分组，例如 ["log", "redact"]
+	for _, f := range fields() {
+		parts := strings.Split(f.Key, ".")
+		parents := parts[:len(parts)-1]
+		// 和上一个配置项不在同一个分组时输出新的分组
+		n := 0
+		for n < len(open) && n < len(parents) && open[n] == parents[n] {
+			n++
+		}
+		for i := n; i < len(parents); i++ {
+			indent := strings.Repeat("  ", i)
+			if i == 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s# %s\n%s%s:\n", indent, sectionDesc(strings.Join(parts[:i+1], ".")), indent, parents[i])
+		}
+		open = parents
+
+		indent := strings.Repeat("  ", len(parents))
+		desc := f.Tag.Get("desc")
+		if _, ok := placeholders[f.Key]; ok {
+			desc += "，必填，下面是示例值"
+		}
+		fmt.Fprintf(&b, "%s# %s (%s)\n", indent, desc, envName(f.Key))
+		fmt.Fprintf(&b, "%s%s: %s\n", indent, parts[len(parts)-1], sampleValue(f))
+	}
+	return b.String()
+}
+
+func sampleValue(f field) string {
+	v, ok := defaults[f.Key]
+	if !ok {
+		v, ok = placeholders[f.Key]
+	}
+	if !ok {
+		v = reflect.Zero(f.Type).Interface()
+	}
+	if s, ok := v.(Secret); ok {
+		v = string(s)
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	if ss, ok := v.([]string); ok {
+		// 列表写成一行，和其他配置项的格式保持一致
+		quoted := make([]string, len(ss))
+		for i, s := range ss {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	out, _ := yaml.Marshal(v)
+	return strings.TrimSpace(string(out))
+}
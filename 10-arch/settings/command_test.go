@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const checkBase = `name: "web_app"
+mysql:
+  host: "127.0.0.1"
+  port: 3306
+  user: "root"
+  dbname: "web_app"
+`
+
+func TestCheckFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "config.yaml")
+	writeFile(t, base, checkBase)
+	writeFile(t, filepath.Join(dir, "config.prod.yaml"), "port: 9000\nmysql:\n  max_open_conns: 20\n")
+	writeFile(t, filepath.Join(dir, "config.test.yaml"), "mysql:\n  max_open_conns: 2\n  max_idle_conns: 5\n")
+	writeFile(t, filepath.Join(dir, "typo.yaml"), checkBase+"prot: 9000\n")
+	writeFile(t, filepath.Join(dir, "partial.yaml"), "port: 9000\n")
+	writeFile(t, filepath.Join(dir, "sample.yaml"), Sample())
+	writeFile(t, filepath.Join(dir, "zero.yaml"), strings.Replace(checkBase, "3306", "0", 1))
+
+	tests := []struct {
+		path string
+		args []string
+		want string // 为空时应该通过
+	}{
+		{base, nil, ""},
+		// profile 文件叠加在 config.yaml 上，必填项来自 config.yaml
+		{filepath.Join(dir, "config.prod.yaml"), nil, ""},
+		// 单个文件合法，合并之后 validate 不通过
+		{filepath.Join(dir, "config.test.yaml"), nil, "mysql.max_idle_conns"},
+		{base, []string{"--mode", "test"}, "mysql.max_idle_conns"},
+		{filepath.Join(dir, "typo.yaml"), nil, "prot"},
+		// 命令行参数和启动时一样生效
+		{base, []string{"--port", "70000"}, "port"},
+		// 不是 profile 文件，缺少必填项
+		{filepath.Join(dir, "partial.yaml"), nil, "name"},
+		// 生成的示例配置可以直接通过
+		{filepath.Join(dir, "sample.yaml"), nil, ""},
+		// 报告的是真正的原因而不是类型
+		{filepath.Join(dir, "zero.yaml"), nil, "mysql.port: 0 小于最小值 1"},
+	}
+	for _, tt := range tests {
+		err := CheckFile(tt.path, tt.args)
+		name := filepath.Base(tt.path) + " " + strings.Join(tt.args, " ")
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got %v, want an error about %s", name, err, tt.want)
+		}
+	}
+}
+
+func TestSplitProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "config.yaml"), checkBase)
+
+	if base, profile, ok := splitProfile(filepath.Join(dir, "config.prod.yaml")); !ok || profile != "prod" || base != filepath.Join(dir, "config.yaml") {
+		t.Errorf("splitProfile = %q, %q, %v", base, profile, ok)
+	}
+	for _, p := range []string{filepath.Join(dir, "config.yaml"), filepath.Join(dir, "other.prod.yaml"), filepath.Join(dir, "config")} {
+		if _, _, ok := splitProfile(p); ok {
+			t.Errorf("%s is not a profile file", p)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package settings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// keyEnv 解密配置使用的密钥，base64 编码的 32 字节
+	keyEnv = envPrefix + "_CONFIG_KEY"
+	// keyFileEnv 保存密钥的文件，keyEnv 没有设置时使用
+	keyFileEnv = envPrefix + "_CONFIG_KEY_FILE"
+)
+
+// encPattern 加密之后的配置值：ENC[AES256_GCM,<base64(nonce + 密文)>]
+var encPattern = regexp.MustCompile(`ENC\[AES256_GCM,([A-Za-z0-9+/=]+)\]`)
+
+// ErrNoKey 配置中有加密的值，但是没有提供密钥
+var ErrNoKey = errors.New("encrypted config value found but neither " + keyEnv + " nor " + keyFileEnv + " is set")
+
+// LoadKey 从环境变量 WEBAPP_CONFIG_KEY 或者 WEBAPP_CONFIG_KEY_FILE 指定的文件中读取密钥
+func LoadKey() ([]byte, error) {
+	if v := os.Getenv(keyEnv); v != "" {
+		return ParseKey(v)
+	}
+	if path := os.Getenv(keyFileEnv); path != "" {
+		return ReadKeyFile(path)
+	}
+	return nil, ErrNoKey
+}
+
+// ReadKeyFile 从文件中读取 base64 编码的密钥
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(b))
+}
+
+// ParseKey 解析 base64 编码的 32 字节密钥
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid config key: need 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// GenerateKey 生成一个随机的密钥，返回 base64 编码
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt 用 AES-256-GCM 加密一个配置值，返回 ENC[AES256_GCM,...]
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+// Decrypt 解密 ENC[AES256_GCM,...]
+// 返回的错误中不会包含密文和明文
+func Decrypt(key []byte, value string) (string, error) {
+	m := encPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil || m[0] != strings.TrimSpace(value) {
+		return "", errors.New("not an ENC[AES256_GCM,...] value")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(m[1])
+	if err != nil {
+		return "", errors.New("decrypt config value failed: invalid base64")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("decrypt config value failed: ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("decrypt config value failed: wrong key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decrypt 配置值是 ENC[...] 时解密，否则原样返回
+func decrypt(s string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(s), "ENC[") {
+		return s, nil
+	}
+	key, err := LoadKey()
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(key, s)
+}
+
+// RotateKey 把 data 中所有用 oldKey 加密的值改用 newKey 重新加密，文件中的其他内容（包括注释）保持不变
+// 返回替换之后的内容以及替换了多少个值
+func RotateKey(data []byte, oldKey, newKey []byte) ([]byte, int, error) {
+	var (
+		n        int
+		firstErr error
+	)
+	out := encPattern.ReplaceAllStringFunc(string(data), func(enc string) string {
+		if firstErr != nil {
+			return enc
+		}
+		plain, err := Decrypt(oldKey, enc)
+		if err != nil {
+			firstErr = err
+			return enc
+		}
+		re, err := Encrypt(newKey, plain)
+		if err != nil {
+			firstErr = err
+			return enc
+		}
+		n++
+		return re
+	})
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	return []byte(out), n, nil
+}
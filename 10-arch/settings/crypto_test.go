@@ -0,0 +1,114 @@
+package settings
+
+import (
+	"encoding/base64"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	s, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := testKey(t)
+	enc, err := Encrypt(key, "p@ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, "ENC[AES256_GCM,") || strings.Contains(enc, "p@ss") {
+		t.Fatalf("unexpected ciphertext %q", enc)
+	}
+	if again, _ := Encrypt(key, "p@ss"); again == enc {
+		t.Fatal("encrypting twice returned the same ciphertext")
+	}
+	if got, err := Decrypt(key, "  "+enc+"\n"); err != nil || got != "p@ss" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	// 改掉密文中的一个字节，直接改 base64 的字符可能只改到了被忽略的填充位
+	sealed, _ := base64.StdEncoding.DecodeString(encPattern.FindStringSubmatch(enc)[1])
+	sealed[len(sealed)-1] ^= 1
+	tampered := "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString(sealed) + "]"
+	for name, value := range map[string]string{
+		"wrong key":     enc,
+		"tampered":      tampered,
+		"not encrypted": "p@ss",
+		"extra text":    enc + "x",
+		"too short":     "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString([]byte("abc")) + "]",
+	} {
+		k := key
+		if name == "wrong key" {
+			k = testKey(t)
+		}
+		got, err := Decrypt(k, value)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %q", name, got)
+			continue
+		}
+		if strings.Contains(err.Error(), "p@ss") || strings.Contains(err.Error(), value) {
+			t.Errorf("%s: error leaks the value: %v", name, err)
+		}
+	}
+}
+
+func TestResolveHookDecrypts(t *testing.T) {
+	key := testKey(t)
+	enc, _ := Encrypt(key, "p@ss")
+	os.Setenv(keyEnv, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(keyEnv)
+	os.Setenv("SETTINGS_TEST_ENC", enc)
+	defer os.Unsetenv("SETTINGS_TEST_ENC")
+
+	for _, in := range []string{enc, "${env:SETTINGS_TEST_ENC}"} {
+		got, err := resolveHook(reflect.TypeOf(""), reflect.TypeOf(""), in)
+		if err != nil || got != "p@ss" {
+			t.Errorf("resolveHook(%q) = %v, %v", in, got, err)
+		}
+	}
+
+	os.Unsetenv(keyEnv)
+	if _, err := resolveHook(reflect.TypeOf(""), reflect.TypeOf(""), enc); err != ErrNoKey {
+		t.Errorf("without a key: err = %v, want ErrNoKey", err)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	a, _ := Encrypt(oldKey, "a")
+	b, _ := Encrypt(oldKey, "b")
+	data := "# 注释保留\nmysql:\n  password: " + a + "\nadmin:\n  token: \"" + b + "\"\n"
+
+	out, n, err := RotateKey([]byte(data), oldKey, newKey)
+	if err != nil || n != 2 {
+		t.Fatalf("RotateKey = %d, %v", n, err)
+	}
+	if !strings.HasPrefix(string(out), "# 注释保留\n") || strings.Contains(string(out), a) {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	for i, enc := range encPattern.FindAllString(string(out), -1) {
+		if got, err := Decrypt(newKey, enc); err != nil || got != []string{"a", "b"}[i] {
+			t.Errorf("value %d: %q, %v", i, got, err)
+		}
+	}
+	if _, _, err := RotateKey([]byte(data), newKey, oldKey); err == nil {
+		t.Error("rotating with the wrong old key should fail")
+	}
+}
+
+func TestHasReferenceEncrypted(t *testing.T) {
+	if !hasReference(" ENC[AES256_GCM,AAAA]") || !hasReference([]interface{}{"ENC[AES256_GCM,AAAA]"}) {
+		t.Fatal("encrypted values should be masked")
+	}
+}
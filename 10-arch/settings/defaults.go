@@ -0,0 +1,46 @@
+package settings
+
+import "github.com/spf13/viper"
+
+// defaults 配置项的默认值，优先级最低，配置文件、环境变量、命令行参数都没有设置时才会使用
+// name 和 mysql 的地址、账号等跟部署相关的配置项没有默认值，必须显式配置
+var defaults = map[string]interface{}{
+	"mode":                       "dev",
+	"port":                       8081,
+	"maintenance":                false,
+	"log.level":                  "info",
+	"log.filename":               "web_app.log",
+	"log.max_size":               200,
+	"log.max_backups":            7,
+	"log.max_age":                30,
+	"log.writer":                 "rotate",
+	"log.compress":               true,
+	"log.local_time":             true,
+	"log.recent_size":            1000,
+	"log.async.enabled":          false,
+	"log.async.queue_size":       4096,
+	"log.async.policy":           "block",
+	"log.async.flush_interval":   "1s",
+	"log.notify.level":           "error",
+	"log.notify.interval":        "5m",
+	"log.notify.timeout":         "5s",
+	"log.redact.headers":         []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+	"log.redact.query":           []string{"token", "access_token", "refresh_token", "password", "secret", "api_key"},
+	"log.redact.body":            []string{"password"},
+	"http.capture.max_bytes":     4096,
+	"http.capture.content_types": []string{"application/json", "application/x-www-form-urlencoded"},
+	"http.slow.threshold":        "1s",
+	"http.slow.keep":             50,
+	"mysql.max_open_conns":       10,
+	"mysql.max_idle_conns":       10,
+	"redis.port":                 6379,
+	"remote.format":              "yaml",
+	"remote.interval":            "10s",
+}
+
+// setDefaults 把默认值设置到 viper 中
+func setDefaults() {
+	for key, value := range defaults {
+		viper.SetDefault(key, value)
+	}
+}
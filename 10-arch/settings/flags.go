@@ -0,0 +1,53 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ErrHelp 命令行中传入了 -h/--help，调用方收到后应该直接退出
+var ErrHelp = pflag.ErrHelp
+
+// flagKeys 命令行参数和配置项 key 的对应关系
+var flagKeys = map[string]string{
+	"port":      "port",
+	"mode":      "mode",
+	"log-level": "log.level",
+}
+
+// newFlagSet 创建命令行参数
+func newFlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("web_app", pflag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.StringP("config", "c", "", "配置文件路径，不指定时在当前目录下查找 config.yaml")
+	fs.IntP("port", "p", 0, "监听端口")
+	fs.String("mode", "", "运行模式，例如 dev、prod")
+	fs.String("log-level", "", "日志级别：debug、info、warn、error")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nFlags:\n%s\n", os.Args[0], fs.FlagUsages())
+		fmt.Fprintln(os.Stderr, "配置项（优先级：运行时修改 > 命令行参数 > 环境变量 > 远程配置 > 配置文件 > 默认值）:")
+		w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "  KEY\tENV")
+		for _, key := range keys() {
+			fmt.Fprintf(w, "  %s\t%s\n", key, envName(key))
+		}
+		_ = w.Flush()
+	}
+	return fs
+}
+
+// bindFlags 把命令行参数绑定到 viper 上
+// 只有在命令行中显式传入的参数才会覆盖环境变量和配置文件
+func bindFlags(fs *pflag.FlagSet) error {
+	for name, key := range flagKeys {
+		if err := viper.BindPFlag(key, fs.Lookup(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package settings
+
+import (
+	"reflect"
+	"strings"
+)
+
+// field 描述 AppConfig 中的一个叶子配置项
+type field struct {
+	Key   string            // viper 中的 key，例如 "log.level"
+	Type  reflect.Type      // 字段类型
+	Tag   reflect.StructTag // 字段上的 tag
+	Index []int             // 从 AppConfig 开始逐层的字段下标
+}
+
+// fields 通过反射遍历 AppConfig 的 mapstructure tag，返回所有叶子配置项
+// 嵌套的结构体（或结构体指针）会展开成 "section.key" 的形式
+func fields() []field {
+	return walk(reflect.TypeOf(AppConfig{}), "", nil)
+}
+
+func walk(t reflect.Type, prefix string, index []int) (out []field) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		idx := append(append([]int(nil), index...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			out = append(out, walk(ft, key, idx)...)
+			continue
+		}
+		out = append(out, field{Key: key, Type: f.Type, Tag: f.Tag, Index: idx})
+	}
+	return out
+}
+
+// value 取出 c 中该配置项的值，所在的分组为 nil 时返回 false
+func (f field) value(c *AppConfig) (reflect.Value, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for _, i := range f.Index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// keys 返回所有叶子配置项的 key
+func keys() []string {
+	fs := fields()
+	ks := make([]string, 0, len(fs))
+	for _, f := range fs {
+		ks = append(ks, f.Key)
+	}
+	return ks
+}
+
+// envName 返回配置项对应的环境变量名，例如 "log.level" -> "WEBAPP_LOG_LEVEL"
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
@@ -0,0 +1,243 @@
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// SourceRuntime 通过管理接口在运行时修改的配置项
+const SourceRuntime Source = "runtime"
+
+// overridable 允许在运行时修改的配置项
+var overridable = map[string]bool{
+	"log.level":            true,
+	"mysql.max_open_conns": true,
+	"mysql.max_idle_conns": true,
+	"maintenance":          true,
+}
+
+// overrides 当前生效的运行时配置，优先级高于其他所有来源，由 reloadMu 保护
+var overrides = map[string]interface{}{}
+
+// Overrides 返回当前生效的运行时配置
+func Overrides() map[string]interface{} {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	out := make(map[string]interface{}, len(overrides))
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
+
+// SetOverrides 在运行时修改配置，changes 中值为 nil 的配置项会撤销之前的修改
+// 修改之后的配置同样要通过校验，校验失败时不会有任何配置项生效
+// 配置了 admin.overrides_file 的时候会持久化到文件中，重启之后仍然生效
+// actor 表示是谁做的修改，会记录到审计日志中
+func SetOverrides(changes map[string]interface{}, actor string) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	var errs ValidationError
+	next := make(map[string]interface{}, len(overrides)+len(changes))
+	for k, v := range overrides {
+		next[k] = v
+	}
+	for k, v := range changes {
+		if !overridable[k] {
+			errs = append(errs, FieldError{Key: k, Msg: "不允许在运行时修改"})
+			continue
+		}
+		if v == nil {
+			delete(next, k)
+		} else if msg := checkOverride(k, v); msg != "" {
+			errs = append(errs, FieldError{Key: k, Msg: msg})
+		} else {
+			next[k] = v
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	s, _, err := load(next)
+	if err != nil {
+		return err
+	}
+	old := snap()
+	overrides = next
+	current.Store(s)
+
+	audit := zap.L().Named("audit")
+	persisted := false
+	if path := overridesFile(s.conf); path != "" {
+		if err := writeOverrides(path, next); err != nil {
+			audit.Error("persist config overrides failed", zap.String("file", path), zap.Error(err))
+		} else {
+			persisted = true
+		}
+	}
+	// 审计日志使用 WARN 级别，避免日志级别被调高之后记录不下来
+	for _, k := range sortedKeys(changes) {
+		audit.Warn("config override",
+			zap.String("key", k),
+			zap.Any("old", effectiveValue(old, k)),
+			zap.Any("new", effectiveValue(s, k)),
+			zap.Bool("reset", changes[k] == nil),
+			zap.String("actor", actor),
+			zap.Bool("persisted", persisted),
+		)
+	}
+
+	notify(old.conf, s.conf)
+	return nil
+}
+
+// checkOverride 检查运行时配置的值能否原样生效，返回不符合的原因
+// applyOverrides 是弱类型的转换，20.5 会被截断成 20，而持久化的文件中保存的还是 20.5
+func checkOverride(key string, v interface{}) string {
+	for _, f := range fields() {
+		if f.Key != key {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			switch n := v.(type) {
+			case float64:
+				if n != math.Trunc(n) {
+					return fmt.Sprintf("应为整数，不能是 %v", n)
+				}
+			case float32:
+				if float64(n) != math.Trunc(float64(n)) {
+					return fmt.Sprintf("应为整数，不能是 %v", n)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// applyOverrides 把运行时配置覆盖到 c 上
+func applyOverrides(c *AppConfig, ov map[string]interface{}) error {
+	if len(ov) == 0 {
+		return nil
+	}
+	// "log.level" -> {"log": {"level": ...}}
+	nested := make(map[string]interface{})
+	for k, v := range ov {
+		m := nested
+		parts := strings.Split(k, ".")
+		for _, p := range parts[:len(parts)-1] {
+			sub, ok := m[p].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[p] = sub
+			}
+			m = sub
+		}
+		m[parts[len(parts)-1]] = v
+	}
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           c,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(nested)
+}
+
+// overridesFile 运行时配置持久化的文件，为空表示不持久化
+func overridesFile(c *AppConfig) string {
+	if c.AdminConfig == nil {
+		return ""
+	}
+	return c.AdminConfig.OverridesFile
+}
+
+// readOverrides 读取持久化的运行时配置，文件不存在时返回空
+func readOverrides(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ov := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &ov); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %v", path, err)
+	}
+	for k, v := range ov {
+		if !overridable[k] {
+			return nil, fmt.Errorf("parse %s failed: %s 不允许在运行时修改", path, k)
+		}
+		if msg := checkOverride(k, v); msg != "" {
+			return nil, fmt.Errorf("parse %s failed: %s: %s", path, k, msg)
+		}
+	}
+	return ov, nil
+}
+
+// writeOverrides 把运行时配置写到文件中
+func writeOverrides(path string, ov map[string]interface{}) error {
+	b, err := yaml.Marshal(ov)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0644)
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免进程中途退出时留下写了一半的文件
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// effectiveValue 取出快照中某个配置项的值，用于审计日志
+func effectiveValue(s *snapshot, key string) interface{} {
+	for _, f := range fields() {
+		if f.Key != key {
+			continue
+		}
+		if v, ok := f.value(s.conf); ok {
+			return redact(s, key, v)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,148 @@
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const overrideConfig = `name: "web_app"
+mysql:
+  host: "127.0.0.1"
+  port: 3306
+  user: "root"
+  dbname: "web_app"
+admin:
+  overrides_file: "%s"
+`
+
+// initOverrides 用持久化到 dir 中的运行时配置初始化，返回持久化的文件
+func initOverrides(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config.override.yaml")
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, configFile, fmt.Sprintf(overrideConfig, path))
+	overrides = map[string]interface{}{}
+	if err := Init([]string{"--config", configFile}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readPersisted(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	ov, err := readOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ov
+}
+
+func TestSetOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := initOverrides(t, dir)
+	defer Close()
+	defer func() { overrides = map[string]interface{}{} }()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	// 修改之后立即生效并持久化
+	if err := SetOverrides(map[string]interface{}{"mysql.max_open_conns": int64(20), "log.level": "debug"}, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if c := Current(); c.MySQLConfig.MaxOpenConns != 20 || c.LogConfig.Level != "debug" {
+		t.Fatalf("overrides not applied: max_open_conns = %d, level = %s", c.MySQLConfig.MaxOpenConns, c.LogConfig.Level)
+	}
+	want := map[string]interface{}{"mysql.max_open_conns": 20, "log.level": "debug"}
+	if got := readPersisted(t, path); !reflect.DeepEqual(got, want) {
+		t.Fatalf("persisted %v, want %v", got, want)
+	}
+
+	// 每个修改的配置项一条审计日志
+	audits := logs.FilterMessage("config override").AllUntimed()
+	if len(audits) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(audits))
+	}
+	fields := audits[1].ContextMap()
+	if audits[1].LoggerName != "audit" || fields["key"] != "mysql.max_open_conns" || fields["old"] != int64(10) ||
+		fields["new"] != int64(20) || fields["actor"] != "tester" || fields["persisted"] != true || fields["reset"] != false {
+		t.Errorf("unexpected audit entry %s %v", audits[1].LoggerName, fields)
+	}
+
+	// 校验不通过时什么都不改
+	rejected := []map[string]interface{}{
+		{"mysql.max_open_conns": 20.5},
+		{"mysql.max_idle_conns": 30, "log.level": "info"}, // max_idle_conns 大于 max_open_conns
+		{"port": 9000},
+		{"log.level": "verbose"},
+	}
+	for _, changes := range rejected {
+		if err := SetOverrides(changes, "tester"); err == nil {
+			t.Errorf("SetOverrides(%v) succeeded", changes)
+		}
+	}
+	if c := Current(); c.MySQLConfig.MaxOpenConns != 20 || c.LogConfig.Level != "debug" {
+		t.Errorf("rejected overrides were applied: max_open_conns = %d, level = %s", c.MySQLConfig.MaxOpenConns, c.LogConfig.Level)
+	}
+	if got := readPersisted(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("persisted %v after rejected overrides, want %v", got, want)
+	}
+
+	// 整数的配置项允许写成没有小数部分的浮点数，JSON 解析出来的就是这样
+	if err := SetOverrides(map[string]interface{}{"mysql.max_idle_conns": float64(5)}, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if n := Current().MySQLConfig.MaxIdleConns; n != 5 {
+		t.Errorf("max_idle_conns = %d, want 5", n)
+	}
+
+	// 值为 nil 时撤销修改
+	if err := SetOverrides(map[string]interface{}{"mysql.max_open_conns": nil, "mysql.max_idle_conns": nil}, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if n := Current().MySQLConfig.MaxOpenConns; n != 10 {
+		t.Errorf("max_open_conns = %d after reset, want the default 10", n)
+	}
+	want = map[string]interface{}{"log.level": "debug"}
+	if got := readPersisted(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("persisted %v after reset, want %v", got, want)
+	}
+	last := logs.FilterMessage("config override").AllUntimed()
+	if f := last[len(last)-1].ContextMap(); f["reset"] != true || f["new"] != int64(10) {
+		t.Errorf("unexpected reset audit entry %v", f)
+	}
+
+	// 重启之后读回持久化的配置
+	Close()
+	if err := Init([]string{"--config", filepath.Join(dir, "config.yaml")}); err != nil {
+		t.Fatal(err)
+	}
+	if l := Current().LogConfig.Level; l != "debug" {
+		t.Errorf("level = %s after restart, want the persisted debug", l)
+	}
+}
+
+func TestReadOverridesRejectsFractions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.override.yaml")
+	writeFile(t, path, "mysql.max_open_conns: 20.5\n")
+	if _, err := readOverrides(path); err == nil {
+		t.Error("readOverrides accepted 20.5 for an integer key")
+	}
+}
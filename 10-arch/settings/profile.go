@@ -0,0 +1,115 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// localProfile 本地开发用的配置文件，不需要提交到代码仓库中
+const localProfile = "local"
+
+// profileFiles 返回需要合并到基础配置文件上的配置文件，按合并的先后顺序排列
+// 例如 base 为 ./config.yaml、mode 为 dev 时返回 ./config.dev.yaml 和 ./config.local.yaml
+func profileFiles(base, mode string) []string {
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+	var files []string
+	if mode != "" {
+		files = append(files, prefix+"."+mode+ext)
+	}
+	return append(files, prefix+"."+localProfile+ext)
+}
+
+// chain 读取配置文件链的结果
+type chain struct {
+	files   []string          // 实际读取到的文件，按合并的先后顺序排列
+	watched []string          // 需要监听变化的文件，包括还不存在的
+	origin  map[string]string // 配置项 -> 最后设置了它的文件
+	remote  map[string]string // 配置项 -> 远程配置中心
+}
+
+// readConfig 依次读取配置文件链：config.yaml -> config.<mode>.yaml -> config.local.yaml，最后合并远程配置
+// 后面的文件深度合并到前面的文件上：map 逐个 key 合并，列表和其他的值整体替换
+// mode 取自基础配置文件、环境变量和命令行参数，不会受后面的配置文件影响
+func readConfig() (*chain, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		// 配置文件未找到或者 --config 指定的文件无法读取
+		return nil, err
+	}
+	base := viper.ConfigFileUsed()
+	ch := &chain{
+		files:   []string{base},
+		watched: []string{base},
+		origin:  make(map[string]string),
+		remote:  make(map[string]string),
+	}
+	bv, err := readFile(base)
+	if err != nil {
+		return nil, err
+	}
+	ch.record(base, bv)
+
+	for _, p := range profileFiles(base, viper.GetString("mode")) {
+		ch.watched = append(ch.watched, p)
+		pv, err := readFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := viper.MergeConfigMap(pv.AllSettings()); err != nil {
+			return nil, fmt.Errorf("merge config file %s failed: %v", p, err)
+		}
+		ch.files = append(ch.files, p)
+		ch.record(p, pv)
+	}
+
+	// 远程配置合并在所有配置文件之上
+	if remoteSource != nil {
+		rv, err := remoteSource.parse()
+		if err != nil {
+			return nil, err
+		}
+		if err := viper.MergeConfigMap(rv.AllSettings()); err != nil {
+			return nil, fmt.Errorf("merge remote config %s failed: %v", remoteSource.name(), err)
+		}
+		for _, key := range rv.AllKeys() {
+			ch.remote[key] = remoteSource.name()
+		}
+	}
+	return ch, nil
+}
+
+// readFile 用单独的 viper 实例读取一个配置文件，文件不存在时返回的错误满足 os.IsNotExist
+func readFile(path string) (*viper.Viper, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config file %s failed: %v", path, err)
+	}
+	return v, nil
+}
+
+// record 记录 file 中设置了哪些配置项
+func (ch *chain) record(file string, v *viper.Viper) {
+	for _, key := range v.AllKeys() {
+		ch.origin[key] = file
+	}
+}
+
+// ConfigFiles 返回当前生效的配置由哪些配置文件合并而来，按合并的先后顺序排列
+func ConfigFiles() []string {
+	s := snap()
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s.files...)
+}
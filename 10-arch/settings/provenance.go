@@ -0,0 +1,131 @@
+package settings
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Source 配置项的生效值来自哪里
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceUnset   Source = "unset" // 没有任何地方设置，使用的是零值
+)
+
+// Origin 配置项的来源，来源是配置文件时 File 为具体的文件，来源是远程配置中心时为配置中心的地址
+type Origin struct {
+	Source Source `json:"source" yaml:"source"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// Entry 配置项的生效值以及来源
+type Entry struct {
+	Value  interface{} `json:"value" yaml:"value"`
+	Origin `yaml:",inline"`
+}
+
+// flags Init 时解析的命令行参数
+var flags *pflag.FlagSet
+
+// origins 按 运行时配置 > 命令行参数 > 环境变量 > 远程配置 > 配置文件 > 默认值 的优先级判断每个配置项的来源
+func origins(ch *chain, ov map[string]interface{}) map[string]Origin {
+	flagOf := make(map[string]string, len(flagKeys))
+	for name, key := range flagKeys {
+		flagOf[key] = name
+	}
+
+	out := make(map[string]Origin)
+	for _, key := range keys() {
+		var o Origin
+		if _, ok := ov[key]; ok {
+			o.Source = SourceRuntime
+		} else if name, ok := flagOf[key]; ok && flags != nil && flags.Changed(name) {
+			o.Source = SourceFlag
+		} else if v, ok := os.LookupEnv(envName(key)); ok && v != "" {
+			// 和 viper 一样，值为空的环境变量当做没有设置
+			o.Source = SourceEnv
+		} else if name, ok := ch.remote[key]; ok {
+			o.Source, o.File = SourceRemote, name
+		} else if file, ok := ch.origin[key]; ok {
+			o.Source, o.File = SourceFile, file
+		} else if _, ok := defaults[key]; ok {
+			o.Source = SourceDefault
+		} else {
+			o.Source = SourceUnset
+		}
+		out[key] = o
+	}
+	return out
+}
+
+// Effective 返回当前生效的配置，按配置文件的层级组织，每个配置项都带上了来源
+// Secret 类型的配置项（密码、token 等）、值来自 ${env:...}、${file:...} 引用或者 ENC[...] 解密的配置项只会输出 ******
+func Effective() map[string]interface{} {
+	s := snap()
+	out := make(map[string]interface{})
+	if s == nil {
+		return out
+	}
+	for _, f := range fields() {
+		e := Entry{Origin: s.origins[f.Key]}
+		if v, ok := f.value(s.conf); ok {
+			e.Value = redact(s, f.Key, v)
+		}
+
+		// "log.level" -> out["log"]["level"]
+		m := out
+		parts := strings.Split(f.Key, ".")
+		for _, p := range parts[:len(parts)-1] {
+			sub, ok := m[p].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[p] = sub
+			}
+			m = sub
+		}
+		m[parts[len(parts)-1]] = e
+	}
+	return out
+}
+
+// redact 敏感的配置项替换成 ******
+func redact(s *snapshot, key string, v reflect.Value) interface{} {
+	if s.resolved[key] {
+		return Mask
+	}
+	if sec, ok := v.Interface().(Secret); ok {
+		return sec.String()
+	}
+	return display(v)
+}
+
+// display 转换成和配置文件写法一致的值：时间间隔输出成 1s 这样的字符串，
+// 结构体的列表（例如 log.sinks）中的每一项按 mapstructure 的 key 输出
+func display(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct || v.IsNil() {
+		return v.Interface()
+	}
+	out := make([]map[string]interface{}, v.Len())
+	for i := range out {
+		item, t := v.Index(i), v.Type().Elem()
+		m := make(map[string]interface{}, t.NumField())
+		for j := 0; j < t.NumField(); j++ {
+			if name := t.Field(j).Tag.Get("mapstructure"); name != "" && name != "-" {
+				m[name] = display(item.Field(j))
+			}
+		}
+		out[i] = m
+	}
+	return out
+}
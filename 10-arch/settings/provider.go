@@ -0,0 +1,72 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPProvider 通过 HTTP 读取 KV 服务中的配置：GET <endpoint>/<key>，响应体就是配置内容
+// 例如 consul 的 http://127.0.0.1:8500/v1/kv，key 写成 web_app/config?raw
+type HTTPProvider struct {
+	endpoint string
+	interval time.Duration
+	client   *http.Client
+}
+
+// NewHTTPProvider 创建 HTTPProvider，interval 为轮询间隔
+func NewHTTPProvider(endpoint string, interval time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *HTTPProvider) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+"/"+strings.TrimLeft(key, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (p *HTTPProvider) Watch(ctx context.Context, key string, onChange func()) error {
+	return poll(ctx, p.interval, func(ctx context.Context) ([]byte, error) {
+		return p.Get(ctx, key)
+	}, onChange)
+}
+
+// DirProvider 用本地目录模拟配置中心，key 对应目录下的文件
+// 可以在本地开发和测试的时候代替真正的配置中心
+type DirProvider struct {
+	dir      string
+	interval time.Duration
+}
+
+// NewDirProvider 创建 DirProvider，interval 为轮询间隔
+func NewDirProvider(dir string, interval time.Duration) *DirProvider {
+	return &DirProvider{dir: dir, interval: interval}
+}
+
+func (p *DirProvider) Get(ctx context.Context, key string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(p.dir, filepath.FromSlash(key)))
+}
+
+func (p *DirProvider) Watch(ctx context.Context, key string, onChange func()) error {
+	return poll(ctx, p.interval, func(ctx context.Context) ([]byte, error) {
+		return p.Get(ctx, key)
+	}, onChange)
+}
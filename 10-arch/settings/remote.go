@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// SourceRemote 来自远程配置中心的配置项
+const SourceRemote Source = "remote"
+
+// Provider 远程配置中心，配置以 YAML/JSON 文本的形式保存在某个 key 下面
+type Provider interface {
+	// Get 读取 key 下面保存的配置内容
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Watch 监听 key 下面的内容，发生变化时调用 onChange，ctx 被取消之后返回
+	Watch(ctx context.Context, key string, onChange func()) error
+}
+
+// remote 当前使用的远程配置中心
+type remote struct {
+	provider Provider
+	cfg      RemoteConfig
+	data     []byte // 最近一次成功加载的内容，由 reloadMu 保护
+	next     []byte // 正在加载的新内容，加载成功之后才替换 data，由 reloadMu 保护
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// name 在配置项来源中展示的名字，例如 http://127.0.0.1:8500/v1/kv/web_app
+func (r *remote) name() string {
+	return r.cfg.Provider + ":" + r.cfg.Endpoint + "/" + r.cfg.Key
+}
+
+var remoteSource *remote
+
+// NewProvider 按配置创建远程配置中心
+func NewProvider(cfg *RemoteConfig) (Provider, error) {
+	switch cfg.Provider {
+	case "http":
+		return NewHTTPProvider(cfg.Endpoint, cfg.Interval), nil
+	case "dir":
+		return NewDirProvider(cfg.Endpoint, cfg.Interval), nil
+	}
+	return nil, fmt.Errorf("unknown remote config provider %q", cfg.Provider)
+}
+
+// initRemote 按配置文件中的 remote 分组连接远程配置中心，并读取一次配置
+// 没有配置远程配置中心时返回 nil
+func initRemote(c *AppConfig) (*remote, error) {
+	if c.RemoteConfig == nil || c.RemoteConfig.Provider == "" {
+		return nil, nil
+	}
+	p, err := NewProvider(c.RemoteConfig)
+	if err != nil {
+		return nil, err
+	}
+	r := &remote{provider: p, cfg: *c.RemoteConfig, done: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if r.data, err = p.Get(ctx, r.cfg.Key); err != nil {
+		return nil, fmt.Errorf("read remote config %s failed: %v", r.name(), err)
+	}
+	return r, nil
+}
+
+// parse 把远程配置的内容解析成配置项，正在加载新的内容时解析新的内容
+func (r *remote) parse() (*viper.Viper, error) {
+	data := r.data
+	if r.next != nil {
+		data = r.next
+	}
+	v := viper.New()
+	v.SetConfigType(r.cfg.Format)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("parse remote config %s failed: %v", r.name(), err)
+	}
+	return v, nil
+}
+
+// start 在后台监听远程配置，调用 stop 停止
+func (r *remote) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.watch(ctx)
+}
+
+// watch 监听远程配置，内容发生变化之后重新加载整个配置，和配置文件变化时一样会通知订阅者
+// 新的内容加载失败时继续使用原来的内容，之后配置文件变化时的热加载不会因为它失败
+func (r *remote) watch(ctx context.Context) {
+	defer close(r.done)
+	err := r.provider.Watch(ctx, r.cfg.Key, func() {
+		getCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		data, err := r.provider.Get(getCtx, r.cfg.Key)
+		if err != nil {
+			zap.L().Error("read remote config failed", zap.String("remote", r.name()), zap.Error(err))
+			return
+		}
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		if bytes.Equal(data, r.data) {
+			return
+		}
+		r.next = data
+		err = reloadLocked(r.name())
+		r.next = nil
+		if err == nil {
+			r.data = data
+		}
+	})
+	if err != nil && err != context.Canceled {
+		zap.L().Error("watch remote config failed", zap.String("remote", r.name()), zap.Error(err))
+	}
+}
+
+// stop 停止监听远程配置，等 watch 返回
+func (r *remote) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// poll 每隔 interval 调用一次 get，内容发生变化时调用 onChange，Provider 可以用它来实现 Watch
+// 第一次读取成功时也会调用 onChange，避免漏掉开始监听之前发生的变化
+func poll(ctx context.Context, interval time.Duration, get func(ctx context.Context) ([]byte, error), onChange func()) error {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	var last [sha256.Size]byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			b, err := get(ctx)
+			if err != nil {
+				zap.L().Warn("poll remote config failed", zap.Error(err))
+				continue
+			}
+			if sum := sha256.Sum256(b); sum != last {
+				last = sum
+				onChange()
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `name: "web_app"
+mysql:
+  host: "127.0.0.1"
+  port: 3306
+  user: "root"
+  dbname: "web_app"
+remote:
+  provider: "dir"
+  endpoint: "%s"
+  key: "web_app.yaml"
+  interval: "20ms"
+`
+
+// eventually 等 cond 成立，最多等 2s
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 用 DirProvider 代替配置中心
+func TestRemoteWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	remoteDir := filepath.Join(dir, "remote")
+	if err := os.Mkdir(remoteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	remoteFile := filepath.Join(remoteDir, "web_app.yaml")
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, remoteFile, "port: 9000\n")
+	writeFile(t, configFile, fmt.Sprintf(testConfig, remoteDir))
+
+	if err := Init([]string{"--config", configFile}); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if p := Current().Port; p != 9000 {
+		t.Fatalf("port = %d, want the remote value 9000", p)
+	}
+
+	// 远程配置校验不通过，继续使用原来的配置和原来的远程内容
+	writeFile(t, remoteFile, "port: 70000\n")
+	time.Sleep(200 * time.Millisecond)
+	reloadMu.Lock()
+	data := string(remoteSource.data)
+	reloadMu.Unlock()
+	if p := Current().Port; p != 9000 || data != "port: 9000\n" {
+		t.Fatalf("bad remote config was applied: port = %d, data = %q", p, data)
+	}
+
+	// 之后配置文件变化时的热加载不受坏掉的远程配置影响
+	writeFile(t, configFile, fmt.Sprintf(testConfig, remoteDir)+"maintenance: true\n")
+	eventually(t, "the config file reload", func() bool { return Current().Maintenance })
+	if p := Current().Port; p != 9000 {
+		t.Fatalf("port = %d after the file reload, want 9000", p)
+	}
+
+	writeFile(t, remoteFile, "port: 9001\n")
+	eventually(t, "the remote reload", func() bool { return Current().Port == 9001 })
+
+	// 停止之后不再热加载
+	Close()
+	writeFile(t, remoteFile, "port: 9002\n")
+	time.Sleep(100 * time.Millisecond)
+	if p := Current().Port; p != 9001 {
+		t.Fatalf("port = %d, remote config was reloaded after Close", p)
+	}
+	reloadMu.Lock()
+	same := bytes.Equal(remoteSource.data, []byte("port: 9001\n"))
+	reloadMu.Unlock()
+	if !same {
+		t.Fatal("remote data changed after Close")
+	}
+}
@@ -0,0 +1,334 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// levels 支持的日志级别
+var levels = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+
+// requiredKeys 必须显式配置的配置项，它们都没有默认值
+var requiredKeys = []string{"name", "mysql.host", "mysql.port", "mysql.user", "mysql.dbname"}
+
+// enums 只能取固定几个值的配置项
+var enums = map[string][]string{
+	"mode":              modes,
+	"log.level":         levels,
+	"log.rotate":        append([]string{""}, rotations...),
+	"log.writer":        writerModes,
+	"log.async.policy":  asyncPolicies,
+	"log.sinks.encoder": encoders,
+	"log.sinks.output":  outputs,
+	"log.sinks.level":   levels,
+	"log.notify.level":  notifyLevels,
+	// 字符串列表的 enum 约束每一项
+	"http.capture.content_types": captureTypes,
+}
+
+// refSchemaPattern 非字符串类型的配置项也可以写成 ${env:...} 这样的引用或者 ENC[...] 加密之后的值
+const refSchemaPattern = `\$\{(env|file):|^ENC\[AES256_GCM,`
+
+// Schema JSON Schema (draft-07) 中用到的部分
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// JSONSchema 通过反射 AppConfig 生成配置文件的 JSON Schema，可以配置到编辑器中做补全和校验
+func JSONSchema() *Schema {
+	root := fileSchema()
+	for _, key := range requiredKeys {
+		parent := root
+		parts := strings.Split(key, ".")
+		for _, p := range parts[:len(parts)-1] {
+			parent.Required = appendOnce(parent.Required, p)
+			parent = parent.Properties[p]
+		}
+		parent.Required = append(parent.Required, parts[len(parts)-1])
+	}
+	return root
+}
+
+// fileSchema 不带必填项的 JSON Schema，用来校验配置文件链中的单个文件
+// 必填的配置项可以写在别的文件中或者来自环境变量，合并之后由 validate 检查
+func fileSchema() *Schema {
+	root := object("web_app config", "")
+	root.SchemaURI = "http://json-schema.org/draft-07/schema#"
+	for _, f := range fields() {
+		parent := root
+		parts := strings.Split(f.Key, ".")
+		for i, p := range parts[:len(parts)-1] {
+			sub, ok := parent.Properties[p]
+			if !ok {
+				sub = object("", sectionDesc(strings.Join(parts[:i+1], ".")))
+				parent.Properties[p] = sub
+			}
+			parent = sub
+		}
+		parent.Properties[parts[len(parts)-1]] = leafSchema(f)
+	}
+	return root
+}
+
+func object(title, desc string) *Schema {
+	no := false
+	return &Schema{
+		Title:                title,
+		Description:          desc,
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: &no,
+	}
+}
+
+func leafSchema(f field) *Schema {
+	s := &Schema{Description: f.Tag.Get("desc"), Default: defaults[f.Key]}
+	if f.Type == reflect.TypeOf(time.Duration(0)) {
+		// 时间间隔写成 10s、1m30s 这样的字符串
+		s.Type = "string"
+		return s
+	}
+	switch f.Type.Kind() {
+	case reflect.String:
+		s.Type = "string"
+		for _, e := range enums[f.Key] {
+			s.Enum = append(s.Enum, e)
+		}
+		return s
+	case reflect.Slice:
+		s.Type = "array"
+		if f.Type.Elem().Kind() == reflect.Struct {
+			// 结构体的列表，例如 log.sinks，每一项的配置项和 enum 都按 "log.sinks.encoder" 这样的 key 查找
+			s.Items = object("", "")
+			for _, sub := range walk(f.Type.Elem(), f.Key, nil) {
+				s.Items.Properties[sub.Key[len(f.Key)+1:]] = leafSchema(sub)
+			}
+		} else {
+			s.Items = &Schema{Type: "string"}
+			for _, e := range enums[f.Key] {
+				s.Items.Enum = append(s.Items.Enum, e)
+			}
+		}
+		return s
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = "integer"
+		min := 0
+		s.Minimum = &min
+		if strings.HasSuffix(f.Key, "port") {
+			min, max := 1, 65535
+			s.Minimum, s.Maximum = &min, &max
+		}
+	default:
+		s.Type = "string"
+		return s
+	}
+	// 非字符串的配置项也允许写成引用
+	typed := &Schema{Type: s.Type, Minimum: s.Minimum, Maximum: s.Maximum}
+	return &Schema{
+		Description: s.Description,
+		Default:     s.Default,
+		AnyOf:       []*Schema{typed, {Type: "string", Pattern: refSchemaPattern}},
+	}
+}
+
+// sectionDesc 返回分组上的 desc tag，key 可以是 "log.redact" 这样嵌套的分组
+func sectionDesc(key string) string {
+	t := reflect.TypeOf(AppConfig{})
+	desc := ""
+	for _, name := range strings.Split(key, ".") {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.Tag.Get("mapstructure") == name {
+				desc, t, found = f.Tag.Get("desc"), f.Type, true
+				break
+			}
+		}
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if !found || t.Kind() != reflect.Struct {
+			return desc
+		}
+	}
+	return desc
+}
+
+func appendOnce(ss []string, s string) []string {
+	for _, x := range ss {
+		if x == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+// Check 用 schema 校验一份配置数据，所有不符合的地方会汇总到 ValidationError 中返回
+func (s *Schema) Check(data interface{}) error {
+	var errs ValidationError
+	s.check("", data, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) check(path string, data interface{}, errs *ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		key := path
+		if key == "" {
+			key = "(root)"
+		}
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.AnyOf) > 0 {
+		var first ValidationError
+		for i, sub := range s.AnyOf {
+			var subErrs ValidationError
+			sub.check(path, data, &subErrs)
+			if len(subErrs) == 0 {
+				return
+			}
+			if i == 0 {
+				first = subErrs
+			}
+		}
+		// 第一个是配置项本来的类型，其他的是引用这样的替代写法，报告本来类型的错误，例如端口小于最小值
+		*errs = append(*errs, first...)
+		return
+	}
+
+	switch s.Type {
+	case "array":
+		list, ok := data.([]interface{})
+		if !ok {
+			fail("应为 array")
+			return
+		}
+		if s.Items != nil {
+			for i, item := range list {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case "object":
+		m, ok := stringMap(data)
+		if !ok {
+			fail("应为 object")
+			return
+		}
+		for _, key := range s.Required {
+			if _, ok := m[key]; !ok {
+				fail("缺少必填的配置项 %s", key)
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub := join(path, k)
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, FieldError{Key: sub, Msg: "未知的配置项"})
+				}
+				continue
+			}
+			prop.check(sub, m[k], errs)
+		}
+	case "string":
+		str, ok := data.(string)
+		if !ok {
+			fail("应为 string")
+			return
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			fail("%q 不匹配 %s", str, s.Pattern)
+		}
+		if len(s.Enum) > 0 && !inEnum(s.Enum, str) {
+			fail("%q 不合法，可选值为 %v", str, s.Enum)
+		}
+	case "boolean":
+		if _, ok := data.(bool); !ok {
+			fail("应为 boolean")
+		}
+	case "integer":
+		n, ok := toInt(data)
+		if !ok {
+			fail("应为 integer")
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("%d 小于最小值 %d", n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("%d 大于最大值 %d", n, *s.Maximum)
+		}
+	}
+}
+
+// stringMap YAML 列表中的 map 解析出来是 map[interface{}]interface{}，统一转换成 map[string]interface{}
+func stringMap(data interface{}) (map[string]interface{}, bool) {
+	switch m := data.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[fmt.Sprint(k)] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func inEnum(enum []interface{}, v string) bool {
+	for _, e := range enum {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// toInt YAML 解析出来的是 int，JSON 解析出来的是 float64
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,194 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Mask 敏感配置项打印出来时的样子，日志脱敏也使用同样的内容
+const Mask = "******"
+
+// Secret 敏感的配置项，例如密码
+// 通过 fmt 打印、zap 记录日志、序列化成 JSON/YAML 时都只会输出 ******，需要明文时调用 Value
+type Secret string
+
+// Value 返回明文
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Mask
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalText 同时作用于 encoding/json 和 yaml.v2
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// refPattern 匹配配置值中的引用：
+//
+//	${env:DB_PASS}                  读取环境变量
+//	${file:/run/secrets/db}         读取文件内容，去掉末尾的换行
+//	${env:DB_PASS:-default}         引用的值不存在时使用 :- 后面的默认值
+//
+// 写成 $${...} 可以得到字面量 ${...}
+var refPattern = regexp.MustCompile(`\$?\$\{(env|file):([^}]*?)(:-([^}]*))?\}`)
+
+// resolve 替换字符串中的所有引用
+// 返回的错误中只包含引用的名字，不会包含解析出来的值
+func resolve(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var firstErr error
+	out := refPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := refPattern.FindStringSubmatch(ref)
+		kind, name, hasDefault, def := m[1], m[2], m[3] != "", m[4]
+
+		var (
+			val string
+			ok  bool
+		)
+		switch kind {
+		case "env":
+			val, ok = os.LookupEnv(name)
+		case "file":
+			b, err := ioutil.ReadFile(name)
+			if err != nil && !os.IsNotExist(err) && firstErr == nil {
+				firstErr = fmt.Errorf("read ${file:%s} failed: %v", name, err)
+			}
+			val, ok = strings.TrimRight(string(b), "\r\n"), err == nil
+		}
+		if ok {
+			return val
+		}
+		if hasDefault {
+			return def
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("${%s:%s} is not set", kind, name)
+		}
+		return ""
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return out, nil
+}
+
+// resolveHook 在 Unmarshal 的时候解析字符串中的引用，并解密 ENC[...] 加密的值
+// viper 中保存的始终是引用和密文本身，解析出来的明文只会出现在 AppConfig 中
+func resolveHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	s, err := resolve(data.(string))
+	if err != nil {
+		return nil, err
+	}
+	// 先解析引用再解密，这样引用的环境变量或者文件中也可以放加密之后的值
+	return decrypt(s)
+}
+
+// resolvedKeys 返回值中带有引用或者 ENC[...] 加密的配置项，解析、解密出来的值可能是密码之类的敏感信息，输出时和 Secret 一样脱敏
+// viper 中保存的是解析之前的原始值，ov 中是运行时修改的值
+func resolvedKeys(ov map[string]interface{}) map[string]bool {
+	out := make(map[string]bool)
+	for _, f := range fields() {
+		raw, ok := ov[f.Key]
+		if !ok {
+			raw = viper.Get(f.Key)
+		}
+		if hasReference(raw) {
+			out[f.Key] = true
+		}
+	}
+	return out
+}
+
+// hasReference 判断原始值（或者切片、map 中的某个值）中是否有会被 resolveHook 替换的引用或者需要解密
+func hasReference(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(v), "ENC[") {
+			return true
+		}
+		for _, ref := range refPattern.FindAllString(v, -1) {
+			// $${...} 是字面量
+			if !strings.HasPrefix(ref, "$$") {
+				return true
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if hasReference(s) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if hasReference(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			if hasReference(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonHook 环境变量的值只能是字符串，结构体的列表（例如 log.sinks）这样的配置项在环境变量中写成 JSON：
+//
+//	WEBAPP_LOG_SINKS='[{"encoder":"json","output":"stdout"}]'
+func jsonHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	switch to.Kind() {
+	case reflect.Slice:
+		if to.Elem().Kind() != reflect.Struct {
+			return data, nil
+		}
+	case reflect.Struct, reflect.Map:
+	default:
+		return data, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(data.(string)), &v); err != nil {
+		return nil, fmt.Errorf("expected a JSON value for %s: %v", to, err)
+	}
+	return v, nil
+}
+
+// decodeHook Unmarshal 时使用的 DecodeHook，在 viper 默认的基础上增加了引用的解析和 JSON 的解析
+func decodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		resolveHook,
+		jsonHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+}
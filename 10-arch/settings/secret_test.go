@@ -0,0 +1,158 @@
+package settings
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "db")
+	writeFile(t, secretFile, "from-file\n")
+	os.Setenv("SETTINGS_TEST_PASS", "from-env")
+	defer os.Unsetenv("SETTINGS_TEST_PASS")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "plain", false},
+		{"${env:SETTINGS_TEST_PASS}", "from-env", false},
+		{"user:${env:SETTINGS_TEST_PASS}@tcp", "user:from-env@tcp", false},
+		{"${file:" + secretFile + "}", "from-file", false},
+		{"${env:SETTINGS_TEST_MISSING:-fallback}", "fallback", false},
+		{"${file:" + filepath.Join(dir, "missing") + ":-fallback}", "fallback", false},
+		{"$${env:SETTINGS_TEST_PASS}", "${env:SETTINGS_TEST_PASS}", false},
+		{"${env:SETTINGS_TEST_MISSING}", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolve(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHasReference(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want bool
+	}{
+		{"plain", false},
+		{3306, false},
+		{"$${env:LITERAL}", false},
+		{"${env:DB_PASS}", true},
+		{"pre-${file:/run/secrets/db}", true},
+		{[]string{"a", "${env:X}"}, true},
+		{[]interface{}{map[string]interface{}{"filename": "${env:LOG_FILE}"}}, true},
+		{[]interface{}{map[string]interface{}{"filename": "app.log"}}, false},
+	}
+	for _, tt := range tests {
+		if got := hasReference(tt.in); got != tt.want {
+			t.Errorf("hasReference(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	c := &AppConfig{
+		Name:        "web_app",
+		MySQLConfig: &MySQLConfig{User: "root", Password: "p@ss"},
+	}
+	s := &snapshot{conf: c, resolved: map[string]bool{"mysql.user": true}}
+	for _, tt := range []struct {
+		key  string
+		want interface{}
+	}{
+		{"name", "web_app"},
+		{"mysql.user", Mask},     // 来自引用，不是 Secret 类型也要脱敏
+		{"mysql.password", Mask}, // Secret
+	} {
+		v := fieldValue(t, c, tt.key)
+		if got := redact(s, tt.key, v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("redact(%s) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+// Effective 中的值和配置文件的写法一致
+func TestRedactDisplay(t *testing.T) {
+	c := &AppConfig{
+		LogConfig: &LogConfig{Sinks: []SinkConfig{{Encoder: "json", Output: "file", Filename: "a.log"}}},
+		HTTPConfig: &HTTPConfig{Slow: SlowConfig{
+			Threshold: time.Second,
+			Routes:    []SlowRoute{{Route: "/users/:id", Threshold: 1500 * time.Millisecond}},
+		}},
+		MySQLConfig: &MySQLConfig{},
+	}
+	s := &snapshot{conf: c}
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"log.sinks", `[{"encoder":"json","filename":"a.log","level":"","output":"file"}]`},
+		{"http.slow.threshold", `"1s"`},
+		{"http.slow.routes", `[{"route":"/users/:id","threshold":"1.5s"}]`},
+		{"http.capture.routes", `null`},
+	} {
+		b, err := json.Marshal(redact(s, tt.key, fieldValue(t, c, tt.key)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s = %s, want %s", tt.key, b, tt.want)
+		}
+	}
+}
+
+func fieldValue(t *testing.T, c *AppConfig, key string) reflect.Value {
+	t.Helper()
+	for _, f := range fields() {
+		if f.Key == key {
+			v, _ := f.value(c)
+			return v
+		}
+	}
+	t.Fatalf("unknown key %s", key)
+	return reflect.Value{}
+}
+
+func TestJSONHook(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []SinkConfig
+		wantErr bool
+	}{
+		{`[{"encoder":"json","output":"stdout"}]`, []SinkConfig{{Encoder: "json", Output: "stdout"}}, false},
+		{`[{"output":"stdout"},{"output":"file","filename":"${env:SETTINGS_TEST_MISSING:-a.log}"}]`,
+			[]SinkConfig{{Output: "stdout"}, {Output: "file", Filename: "a.log"}}, false},
+		{`stdout,file`, nil, true},
+	}
+	for _, tt := range tests {
+		v := viper.New()
+		v.Set("sinks", tt.in)
+		var got struct {
+			Sinks []SinkConfig `mapstructure:"sinks"`
+		}
+		err := v.Unmarshal(&got, decodeHook())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got.Sinks, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.in, got.Sinks, tt.want)
+		}
+	}
+}
@@ -2,85 +2,324 @@ package settings
 
 import (
 	"fmt"
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var Conf = new(AppConfig)
+// envPrefix 环境变量前缀，所有配置项都可以通过 WEBAPP_ 开头的环境变量覆盖
+const envPrefix = "WEBAPP"
 
+// envKeyReplacer 把嵌套 key 中的 "." 换成 "_"，例如 mysql.password -> WEBAPP_MYSQL_PASSWORD
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// snapshot 某一次加载得到的配置，以及它是由哪些文件合并而来的、每个配置项的来源
+type snapshot struct {
+	conf     *AppConfig
+	files    []string
+	origins  map[string]Origin
+	resolved map[string]bool // 值来自引用或者解密的配置项，见 resolvedKeys
+}
+
+// current 保存当前生效的配置快照 (*snapshot)
+// 热加载时会先完整地解析并校验新的配置，然后再整体原子替换，读配置的 goroutine 不需要加锁
+var current atomic.Value
+
+// reloadMu 保证同一时间只有一个 goroutine 在重新加载配置
+var reloadMu sync.Mutex
+
+func snap() *snapshot {
+	s, _ := current.Load().(*snapshot)
+	return s
+}
+
+// Current 返回当前生效的配置快照
+// 快照在替换之后不会再被修改，调用方也不要修改它；需要最新的配置时每次重新调用 Current
+func Current() *AppConfig {
+	if s := snap(); s != nil {
+		return s.conf
+	}
+	return nil
+}
+
+// AppConfig 配置文件中的所有配置项
+// desc tag 是配置项的说明，生成示例配置和 JSON Schema 的时候会用到（见 `web_app config sample`）
 type AppConfig struct {
-	Name         string `mapstructure:"name"`
-	Mode         string `mapstructure:"mode"`
-	Version      string `mapstructure:"version"`
-	Port         int    `mapstructure:"port"`
-	*LogConfig   `mapstructure:"log"`
-	*MySQLConfig `mapstructure:"mysql"`
-	*RedisConfig `mapstructure:"redis"`
+	Name          string `mapstructure:"name" desc:"服务名称"`
+	Mode          string `mapstructure:"mode" desc:"运行模式：dev、test、prod，同时决定合并哪个 config.<mode>.yaml"`
+	Version       string `mapstructure:"version" desc:"服务版本"`
+	Port          int    `mapstructure:"port" desc:"HTTP 监听端口"`
+	Maintenance   bool   `mapstructure:"maintenance" desc:"维护模式，开启后除管理接口外的请求都返回 503"`
+	*LogConfig    `mapstructure:"log" desc:"日志"`
+	*HTTPConfig   `mapstructure:"http" desc:"HTTP 请求"`
+	*MySQLConfig  `mapstructure:"mysql" desc:"MySQL"`
+	*RedisConfig  `mapstructure:"redis" desc:"Redis"`
+	*AdminConfig  `mapstructure:"admin" desc:"管理接口"`
+	*RemoteConfig `mapstructure:"remote" desc:"远程配置中心"`
 }
 
 type LogConfig struct {
-	Level      string `mapstructure:"level"`
-	Filename   string `mapstructure:"filename"`
-	MaxSize    int    `mapstructure:"max_size"`
-	MaxBackups int    `mapstructure:"max_backups"`
-	MaxAge     int    `mapstructure:"max_age"`
+	Level      string `mapstructure:"level" desc:"日志级别：debug、info、warn、error、dpanic、panic、fatal"`
+	Filename   string `mapstructure:"filename" desc:"日志文件路径"`
+	MaxSize    int    `mapstructure:"max_size" desc:"单个日志文件的最大大小，单位 MB，0 表示不按大小切割"`
+	MaxBackups int    `mapstructure:"max_backups" desc:"最多保留多少个旧的日志文件"`
+	MaxAge     int    `mapstructure:"max_age" desc:"旧的日志文件最多保留多少天"`
+	Writer     string `mapstructure:"writer" desc:"日志文件的写入方式：rotate 由程序自己切割；reopen 只写文件，收到 SIGUSR1 后重新打开，配合系统的 logrotate 使用"`
+	// 按大小和按时间切割可以同时开启，哪个条件先满足就先切割，writer 为 reopen 时切割相关的配置不生效
+	Rotate       string `mapstructure:"rotate" desc:"按时间切割：hourly、daily，为空时不按时间切割"`
+	MaxTotalSize int    `mapstructure:"max_total_size" desc:"每个日志文件连同切割出来的旧文件最多占用多少 MB，超过之后从最旧的文件开始删除，0 表示不限制"`
+	Compress     bool   `mapstructure:"compress" desc:"是否用 gzip 压缩切割出来的旧文件"`
+	LocalTime    bool   `mapstructure:"local_time" desc:"切割的时间点和旧文件名中的时间使用本地时间，否则使用 UTC"`
+	// Sinks 为空时按 mode 使用默认的输出：
+	// dev 模式输出到终端和日志文件，其他模式只输出到日志文件，error 及以上级别的日志还会单独写一份到 *.error.log
+	Sinks  []SinkConfig `mapstructure:"sinks" desc:"日志输出，为空时按 mode 使用默认的输出；用环境变量设置时写成 JSON，例如 [{\"encoder\":\"json\",\"output\":\"stdout\"}]"`
+	Redact RedactConfig `mapstructure:"redact" desc:"访问日志和 panic 日志中需要脱敏的内容"`
+	Async  AsyncConfig  `mapstructure:"async" desc:"异步写日志，日志先放到队列中，由后台的 goroutine 批量写入，请求不用等待磁盘 IO"`
+	Notify NotifyConfig `mapstructure:"notify" desc:"出现 panic 和 error 日志时发送通知，相同的问题按指纹去重限流"`
+	// RecentSize 最近的日志保存在内存中，可以通过 /admin/logs 查询，/admin/logs/tail 实时查看
+	RecentSize int `mapstructure:"recent_size" desc:"在内存中保留最近多少条日志，供管理接口查询和实时查看，0 表示不保留"`
+}
+
+// AsyncConfig 异步写日志的配置
+type AsyncConfig struct {
+	Enabled       bool          `mapstructure:"enabled" desc:"是否开启异步写日志"`
+	QueueSize     int           `mapstructure:"queue_size" desc:"每个日志输出的队列最多缓存多少条日志"`
+	Policy        string        `mapstructure:"policy" desc:"队列满了之后的处理方式：block 等待；drop-newest 丢弃新的日志；drop-debug-first 先丢弃 debug 日志，error 及以上级别不丢弃"`
+	FlushInterval time.Duration `mapstructure:"flush_interval" desc:"刷新缓冲的间隔，例如 1s"`
+}
+
+// NotifyConfig 出现 panic 和 error 日志时的通知，webhook 为空时不通知
+type NotifyConfig struct {
+	Webhook  string        `mapstructure:"webhook" desc:"接收通知的地址，以 JSON POST，为空时不通知"`
+	Secret   Secret        `mapstructure:"secret" desc:"签名的密钥，不为空时请求头带上 X-Notify-Signature: sha256=<HMAC-SHA256>"`
+	Level    string        `mapstructure:"level" desc:"达到这个级别的日志发送通知：error、dpanic、panic、fatal，handler 中的 panic 始终通知"`
+	Interval time.Duration `mapstructure:"interval" desc:"同一个问题多久通知一次，期间的重复只计数，周期结束时汇总发送，例如 5m"`
+	Timeout  time.Duration `mapstructure:"timeout" desc:"每次发送的超时时间，例如 5s"`
+}
+
+// RedactConfig 日志脱敏的规则，请求头和查询参数的名字不区分大小写
+type RedactConfig struct {
+	Headers []string `mapstructure:"headers" desc:"需要脱敏的请求头"`
+	Query   []string `mapstructure:"query" desc:"需要脱敏的查询参数"`
+	Body    []string `mapstructure:"body" desc:"需要脱敏的 JSON 请求体字段路径，例如 password、user.id_card，数组会逐个元素处理"`
+	Salt    Secret   `mapstructure:"salt" desc:"不为空时用加盐的哈希代替 ******，相同的值脱敏之后仍然相同，方便关联排查"`
+}
+
+// SinkConfig 一个日志输出，文件的切割配置和 log 分组共用
+type SinkConfig struct {
+	Encoder  string `mapstructure:"encoder" json:"encoder" yaml:"encoder" desc:"编码格式：console、json"`
+	Level    string `mapstructure:"level" json:"level" yaml:"level" desc:"该输出的最低日志级别，为空时只受 log.level 控制"`
+	Output   string `mapstructure:"output" json:"output" yaml:"output" desc:"输出位置：stdout、stderr、file"`
+	Filename string `mapstructure:"filename" json:"filename" yaml:"filename" desc:"output 为 file 时的文件路径，为空时使用 log.filename"`
+}
+
+// HTTPConfig HTTP 请求相关的配置
+type HTTPConfig struct {
+	Slow    SlowConfig    `mapstructure:"slow" desc:"慢请求，超过阈值的请求记录一条 warn 日志，并保留最慢的一部分供 /admin/slow 查看"`
+	Capture CaptureConfig `mapstructure:"capture" desc:"在访问日志中记录请求体和响应体，按接口开启，内容按 log.redact 脱敏"`
+}
+
+// CaptureConfig 记录请求体和响应体的配置
+type CaptureConfig struct {
+	Routes       []string `mapstructure:"routes" desc:"需要记录的接口，路由模板或者 path.Match 的通配符，为空时都不记录"`
+	MaxBytes     int      `mapstructure:"max_bytes" desc:"请求体和响应体各自最多记录多少字节，超过的部分不记录"`
+	ContentTypes []string `mapstructure:"content_types" desc:"只记录这些 Content-Type 的内容：application/json、application/x-www-form-urlencoded"`
+}
+
+// SlowConfig 慢请求的阈值，routes 中第一个匹配的规则优先，都不匹配时使用 threshold
+type SlowConfig struct {
+	Threshold time.Duration `mapstructure:"threshold" desc:"全局的阈值，例如 1s，0 表示只对 routes 中的接口检测"`
+	Routes    []SlowRoute   `mapstructure:"routes" desc:"按接口设置的阈值"`
+	Keep      int           `mapstructure:"keep" desc:"最多保留多少个最近的慢请求，0 表示不保留"`
+}
+
+// SlowRoute 一个接口的慢请求阈值
+type SlowRoute struct {
+	Route     string        `mapstructure:"route" json:"route" yaml:"route" desc:"路由模板，例如 /users/:id，也可以是 path.Match 的通配符，例如 /admin/*"`
+	Threshold time.Duration `mapstructure:"threshold" json:"threshold" yaml:"threshold" desc:"该接口的阈值，0 表示不检测"`
 }
 
 type MySQLConfig struct {
-	Host         string `mapstructure:"host"`
-	Port         int    `mapstructure:"port"`
-	User         string `mapstructure:"user"`
-	Password     string `mapstructure:"password"`
-	Dbname       string `mapstructure:"dbname"`
-	MaxOpenConns int    `mapstructure:"max_open_conns"`
-	MaxIdleConns int    `mapstructure:"max_idle_conns"`
+	Host         string `mapstructure:"host" desc:"MySQL 地址"`
+	Port         int    `mapstructure:"port" desc:"MySQL 端口"`
+	User         string `mapstructure:"user" desc:"MySQL 用户名"`
+	Password     Secret `mapstructure:"password" desc:"MySQL 密码，建议写成 ${env:DB_PASS} 或者 ${file:/run/secrets/db} 这样的引用"`
+	Dbname       string `mapstructure:"dbname" desc:"数据库名"`
+	MaxOpenConns int    `mapstructure:"max_open_conns" desc:"最大连接数，0 表示不限制"`
+	MaxIdleConns int    `mapstructure:"max_idle_conns" desc:"最大空闲连接数，不能大于 max_open_conns"`
 }
 
 type RedisConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
-	Db   int    `mapstructure:"db"`
-}
-
-func Init() (err error) {
-	// 方式1：直接指定配置文件的路径，（相对路径或者绝对路径）
-	// 相对路径：相对于可执行文件的路径
-	// 绝对路径：系统中实际的文件路径
-	// viper.SetConfigFile("./conf/config.yaml")
-	// viper.SetConfigFile("/Users/...")
-
-	// 方式2：指定配置文件名和配置文件的位置，viper自己查找可用的配置文件
-	// 配置文件名不需要带后缀
-	// 配置文件位置可以配置多个
-	viper.SetConfigName("config") // 所以在目录下不要写同名字的配置文件，因为会混乱
-	viper.AddConfigPath(".")
-
-	// 下面这个基本是通过配置中心使用的，例如远程的etcd，告诉viper当前的数据使用什么格式去解析
-	// viper.SetConfigType("yaml")
-
-	// 查找并读取配置文件
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// 配置文件未找到错误
-			fmt.Println("viper.ReadInConfig() failed : ", err)
+	Host string `mapstructure:"host" desc:"Redis 地址，为空时不使用 Redis"`
+	Port int    `mapstructure:"port" desc:"Redis 端口"`
+	Db   int    `mapstructure:"db" desc:"Redis 数据库编号"`
+}
+
+// AdminConfig 管理接口的配置，token 为空时不开放管理接口
+type AdminConfig struct {
+	Token         Secret `mapstructure:"token" desc:"管理接口的 token，请求时带上 Authorization: Bearer <token>，为空时不开放管理接口"`
+	OverridesFile string `mapstructure:"overrides_file" desc:"运行时修改的配置持久化到这个文件中，为空时不持久化"`
+}
+
+// RemoteConfig 远程配置中心的配置
+// 远程配置的优先级高于配置文件、低于环境变量和命令行参数
+// 只在启动的时候读取，修改之后需要重启服务才能生效
+type RemoteConfig struct {
+	Provider string        `mapstructure:"provider" desc:"远程配置中心：http、dir，为空时不使用"`
+	Endpoint string        `mapstructure:"endpoint" desc:"http 时为 KV 服务的地址，例如 http://127.0.0.1:8500/v1/kv；dir 时为本地目录"`
+	Key      string        `mapstructure:"key" desc:"配置保存在哪个 key 下面"`
+	Format   string        `mapstructure:"format" desc:"配置内容的格式：yaml、json"`
+	Interval time.Duration `mapstructure:"interval" desc:"轮询远程配置的间隔，例如 10s"`
+}
+
+// Init 解析命令行参数 args（不包含程序名）并加载配置
+// 配置的优先级从高到低为：
+//  0. 通过管理接口在运行时修改的配置，见 SetOverrides
+//  1. 命令行参数，例如 --port、--mode、--log-level
+//  2. 环境变量，例如 WEBAPP_PORT、WEBAPP_LOG_LEVEL、WEBAPP_MYSQL_PASSWORD
+//  3. 远程配置中心，见 RemoteConfig
+//  4. 配置文件，默认为当前目录下的 config.yaml，可以用 --config 指定
+//     之后按 mode 合并 config.<mode>.yaml，最后合并 config.local.yaml，详见 readConfig
+//  5. 默认值，见 defaults
+//
+// 配置文件链中任何一个文件或者远程配置发生变化都会热加载，热加载时命令行参数和环境变量同样会覆盖配置文件中的值
+// 传入 -h/--help 时打印帮助信息并返回 ErrHelp，配置校验失败时返回 ValidationError
+func Init(args []string) (err error) {
+	fs := newFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if path, _ := fs.GetString("config"); path != "" {
+		// 方式1：直接指定配置文件的路径，（相对路径或者绝对路径）
+		// 相对路径：相对于可执行文件的路径
+		// 绝对路径：系统中实际的文件路径
+		viper.SetConfigFile(path)
+	} else {
+		// 方式2：指定配置文件名和配置文件的位置，viper自己查找可用的配置文件
+		// 配置文件名不需要带后缀
+		// 配置文件位置可以配置多个
+		viper.SetConfigName("config") // 所以在目录下不要写同名字的配置文件，因为会混乱
+		viper.AddConfigPath(".")
+	}
+
+	// 环境变量和命令行参数覆盖配置文件，配置文件覆盖默认值
+	setDefaults()
+	bindEnvs()
+	if err := bindFlags(fs); err != nil {
+		return err
+	}
+	flags = fs
+
+	s, ch, err := load(nil)
+	if err != nil {
+		fmt.Println("load config failed : ", err)
+		return err
+	}
+	// 连接远程配置中心，例如 consul、etcd 这样的 KV 服务，remote.format 告诉 viper 用什么格式去解析
+	if remoteSource, err = initRemote(s.conf); err != nil {
+		return err
+	}
+	// 加载上次运行时修改并持久化下来的配置
+	ov := map[string]interface{}{}
+	if path := overridesFile(s.conf); path != "" {
+		if ov, err = readOverrides(path); err != nil {
 			return err
 		}
 	}
+	if remoteSource != nil || len(ov) > 0 {
+		if s, ch, err = load(ov); err != nil {
+			fmt.Println("load config failed : ", err)
+			return err
+		}
+		overrides = ov
+	}
+	current.Store(s)
 
-	// 把读取到的配置信息反序列化到Conf变量中
-	if err := viper.Unmarshal(Conf); err != nil {
-		fmt.Println("viper.Unmarshal failed, err:", err)
+	// 支持热加载，远程配置的变化也要更新监听的文件，所以先监听配置文件
+	if err := watch(ch.watched); err != nil {
+		return err
+	}
+	if remoteSource != nil {
+		remoteSource.start()
 	}
+	return nil
+}
 
-	// 支持热加载
-	viper.WatchConfig()
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		// 配置文件发生变化后会调用的回调函数, 这里就是重新序列化到 Conf 中去
-		fmt.Println("Config file changed:", e.Name)
-		if err := viper.Unmarshal(Conf); err != nil {
-			fmt.Println("viper.Unmarshal failed, err:", err)
-		}
-	})
+// load 读取配置文件链，反序列化到一个新的 AppConfig 中，覆盖上运行时配置 ov 之后校验
+func load(ov map[string]interface{}) (*snapshot, *chain, error) {
+	ch, err := readConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := new(AppConfig)
+	// 反序列化的同时解析 ${env:...}、${file:...} 这样的引用
+	if err := viper.Unmarshal(c, decodeHook()); err != nil {
+		return nil, nil, err
+	}
+	if err := applyOverrides(c, ov); err != nil {
+		return nil, nil, err
+	}
+	// 校验配置，有问题的配置项会一次性全部返回
+	if err := validate(c, viper.AllKeys()); err != nil {
+		return nil, nil, err
+	}
+	return &snapshot{conf: c, files: ch.files, origins: origins(ch, ov), resolved: resolvedKeys(ov)}, ch, nil
+}
 
+// reload 重新加载配置，新配置解析或校验失败时继续使用上一份正确的配置
+func reload(file string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	_ = reloadLocked(file)
+}
+
+// reloadLocked 重新加载配置，调用方需要持有 reloadMu，加载失败时返回错误
+func reloadLocked(file string) error {
+	zap.L().Info("config file changed, reloading", zap.String("file", file))
+	s, ch, err := load(overrides)
+	if err != nil {
+		zap.L().Error("reload config failed, keep the last known good config",
+			zap.String("file", file), zap.Error(err))
+		return err
+	}
+	if fileWatcher != nil {
+		if err := fileWatcher.set(ch.watched); err != nil {
+			zap.L().Error("watch config files failed", zap.Error(err))
+		}
+	}
+	old := Current()
+	current.Store(s)
+	zap.L().Info("config reloaded", zap.String("file", file), zap.Strings("files", s.files))
+	// 通知订阅了配置变化的各个模块
+	notify(old, s.conf)
 	return nil
 }
+
+// Close 停止监听远程配置和配置文件，退出前调用，之后配置不再热加载
+func Close() {
+	if remoteSource != nil {
+		remoteSource.stop()
+	}
+	reloadMu.Lock()
+	w := fileWatcher
+	fileWatcher = nil
+	reloadMu.Unlock()
+	if w != nil {
+		w.close()
+	}
+}
+
+// bindEnvs 为每一个配置项绑定对应的环境变量
+// 只用 AutomaticEnv 的话，配置文件里没有出现的 key 不会被 Unmarshal 读到，所以这里逐个绑定
+func bindEnvs() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
+	for _, key := range keys() {
+		_ = viper.BindEnv(key, envName(key))
+	}
+}
@@ -0,0 +1,109 @@
+package settings
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Section 配置分组，对应配置文件中的一级 key
+type Section string
+
+const (
+	SectionApp    Section = "app" // name、mode、version、port、maintenance 等顶层配置
+	SectionLog    Section = "log"
+	SectionHTTP   Section = "http"
+	SectionMySQL  Section = "mysql"
+	SectionRedis  Section = "redis"
+	SectionAdmin  Section = "admin"
+	SectionRemote Section = "remote"
+)
+
+// sections 通知订阅者时的固定顺序
+var sections = []Section{SectionApp, SectionLog, SectionHTTP, SectionMySQL, SectionRedis, SectionAdmin, SectionRemote}
+
+// Subscriber 配置发生变化时的回调，old 和 new 都是只读的配置快照
+// 返回的错误只会被记录下来，不会影响其他订阅者和配置的热加载
+type Subscriber func(old, new *AppConfig) error
+
+type subscription struct {
+	section Section
+	fn      Subscriber
+}
+
+var (
+	subMu       sync.Mutex
+	subscribers = make(map[Section][]subscription)
+)
+
+// Subscribe 订阅某个配置分组的变化
+// 热加载之后，只有发生了变化的分组的订阅者会被调用
+// 调用顺序是固定的：先按 app、log、http、mysql、redis、admin、remote 的分组顺序，同一个分组内按订阅的先后顺序
+func Subscribe(section Section, fn Subscriber) {
+	subMu.Lock()
+	defer subMu.Unlock()
+	subscribers[section] = append(subscribers[section], subscription{section: section, fn: fn})
+}
+
+// changed 返回 old 和 new 之间发生了变化的分组
+func changed(old, new *AppConfig) []Section {
+	var out []Section
+	for _, s := range sections {
+		if !reflect.DeepEqual(section(old, s), section(new, s)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func section(c *AppConfig, s Section) interface{} {
+	switch s {
+	case SectionApp:
+		return [...]interface{}{c.Name, c.Mode, c.Version, c.Port, c.Maintenance}
+	case SectionLog:
+		return c.LogConfig
+	case SectionHTTP:
+		return c.HTTPConfig
+	case SectionMySQL:
+		return c.MySQLConfig
+	case SectionRedis:
+		return c.RedisConfig
+	case SectionAdmin:
+		return c.AdminConfig
+	case SectionRemote:
+		return c.RemoteConfig
+	}
+	return nil
+}
+
+// notify 依次通知发生了变化的分组的订阅者
+func notify(old, new *AppConfig) {
+	subMu.Lock()
+	var calls []subscription
+	for _, s := range changed(old, new) {
+		calls = append(calls, subscribers[s]...)
+	}
+	subMu.Unlock()
+
+	for _, sub := range calls {
+		if err := call(sub, old, new); err != nil {
+			zap.L().Error("config subscriber failed",
+				zap.String("section", string(sub.section)),
+				zap.String("subscriber", runtime.FuncForPC(reflect.ValueOf(sub.fn).Pointer()).Name()),
+				zap.Error(err))
+		}
+	}
+}
+
+// call 调用订阅者，订阅者 panic 也不能把监听配置的 goroutine 搞挂
+func call(sub subscription, old, new *AppConfig) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sub.fn(old, new)
+}
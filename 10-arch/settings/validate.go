@@ -0,0 +1,236 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// modes 支持的运行模式
+var modes = []string{"dev", "test", "prod"}
+
+// encoders、outputs 日志输出支持的编码格式和输出位置
+var (
+	encoders = []string{"console", "json"}
+	outputs  = []string{"stdout", "stderr", "file"}
+)
+
+// captureTypes 访问日志中可以记录的请求体和响应体的类型，只有这些类型能够按规则脱敏
+var captureTypes = []string{"application/json", "application/x-www-form-urlencoded"}
+
+// notifyLevels 可以发送通知的日志级别
+var notifyLevels = []string{"error", "dpanic", "panic", "fatal"}
+
+// rotations 按时间切割日志文件的周期
+var rotations = []string{"hourly", "daily"}
+
+// writerModes 日志文件的写入方式
+var writerModes = []string{"rotate", "reopen"}
+
+// asyncPolicies 异步写日志时队列满了的处理方式
+var asyncPolicies = []string{"block", "drop-newest", "drop-debug-first"}
+
+// FieldError 某一个配置项校验失败的原因
+type FieldError struct {
+	Key string
+	Msg string
+}
+
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// ValidationError 配置校验失败，汇总了所有出错的配置项
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config (%d errors):", len(e))
+	for _, fe := range e {
+		b.WriteString("\n  - ")
+		b.WriteString(fe.Error())
+	}
+	return b.String()
+}
+
+// validator 收集校验过程中发现的错误
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) addf(key, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Key: key, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf(key, "不能为空")
+	}
+}
+
+func (v *validator) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		v.addf(key, "端口 %d 不在 1-65535 范围内", port)
+	}
+}
+
+func (v *validator) nonNegative(key string, n int) {
+	if n < 0 {
+		v.addf(key, "不能小于 0，当前为 %d", n)
+	}
+}
+
+func (v *validator) oneOf(key, value string, options []string) {
+	for _, o := range options {
+		if value == o {
+			return
+		}
+	}
+	v.addf(key, "%q 不合法，可选值为 %s", value, strings.Join(options, "/"))
+}
+
+// validate 校验反序列化之后的配置，settingKeys 为配置来源中出现的所有 key，用来发现拼写错误的配置项
+// 所有的错误会汇总到一个 ValidationError 中返回
+func validate(c *AppConfig, settingKeys []string) error {
+	v := new(validator)
+
+	known := make(map[string]bool)
+	for _, key := range keys() {
+		known[key] = true
+	}
+	var unknown []string
+	for _, key := range settingKeys {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		v.addf(key, "未知的配置项")
+	}
+
+	v.required("name", c.Name)
+	v.oneOf("mode", c.Mode, modes)
+	v.port("port", c.Port)
+
+	if c.LogConfig == nil {
+		v.addf("log", "缺少配置")
+	} else {
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(c.LogConfig.Level)); err != nil {
+			v.addf("log.level", "未知的日志级别 %q", c.LogConfig.Level)
+		}
+		v.required("log.filename", c.LogConfig.Filename)
+		v.nonNegative("log.max_size", c.LogConfig.MaxSize)
+		v.nonNegative("log.max_backups", c.LogConfig.MaxBackups)
+		v.nonNegative("log.max_age", c.LogConfig.MaxAge)
+		v.oneOf("log.writer", c.LogConfig.Writer, writerModes)
+		v.nonNegative("log.max_total_size", c.LogConfig.MaxTotalSize)
+		v.nonNegative("log.recent_size", c.LogConfig.RecentSize)
+		if c.LogConfig.Rotate != "" {
+			v.oneOf("log.rotate", c.LogConfig.Rotate, rotations)
+		}
+		if a := c.LogConfig.Async; a.Enabled {
+			if a.QueueSize <= 0 {
+				v.addf("log.async.queue_size", "必须大于 0")
+			}
+			v.oneOf("log.async.policy", a.Policy, asyncPolicies)
+			if a.FlushInterval <= 0 {
+				v.addf("log.async.flush_interval", "必须大于 0")
+			}
+		}
+		if n := c.LogConfig.Notify; n.Webhook != "" {
+			if u, err := url.Parse(n.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.addf("log.notify.webhook", "不是合法的 http(s) 地址")
+			}
+			v.oneOf("log.notify.level", n.Level, notifyLevels)
+			if n.Interval <= 0 {
+				v.addf("log.notify.interval", "必须大于 0")
+			}
+			if n.Timeout <= 0 {
+				v.addf("log.notify.timeout", "必须大于 0")
+			}
+		}
+		for i, s := range c.LogConfig.Sinks {
+			key := fmt.Sprintf("log.sinks[%d]", i)
+			v.oneOf(key+".encoder", s.Encoder, encoders)
+			v.oneOf(key+".output", s.Output, outputs)
+			if s.Level != "" {
+				if err := l.UnmarshalText([]byte(s.Level)); err != nil {
+					v.addf(key+".level", "未知的日志级别 %q", s.Level)
+				}
+			}
+		}
+	}
+
+	if c.HTTPConfig != nil {
+		s := c.HTTPConfig.Slow
+		if s.Threshold < 0 {
+			v.addf("http.slow.threshold", "不能小于 0")
+		}
+		v.nonNegative("http.slow.keep", s.Keep)
+		for i, r := range s.Routes {
+			key := fmt.Sprintf("http.slow.routes[%d]", i)
+			v.required(key+".route", r.Route)
+			if _, err := path.Match(r.Route, ""); err != nil {
+				v.addf(key+".route", "通配符不合法：%v", err)
+			}
+			if r.Threshold < 0 {
+				v.addf(key+".threshold", "不能小于 0")
+			}
+		}
+		cp := c.HTTPConfig.Capture
+		for i, r := range cp.Routes {
+			key := fmt.Sprintf("http.capture.routes[%d]", i)
+			v.required(key, r)
+			if _, err := path.Match(r, ""); err != nil {
+				v.addf(key, "通配符不合法：%v", err)
+			}
+		}
+		if len(cp.Routes) > 0 && cp.MaxBytes <= 0 {
+			v.addf("http.capture.max_bytes", "必须大于 0")
+		}
+		for i, t := range cp.ContentTypes {
+			v.oneOf(fmt.Sprintf("http.capture.content_types[%d]", i), t, captureTypes)
+		}
+	}
+
+	if c.MySQLConfig == nil {
+		v.addf("mysql", "缺少配置")
+	} else {
+		v.required("mysql.host", c.MySQLConfig.Host)
+		v.port("mysql.port", c.MySQLConfig.Port)
+		v.required("mysql.user", c.MySQLConfig.User)
+		v.required("mysql.dbname", c.MySQLConfig.Dbname)
+		v.nonNegative("mysql.max_open_conns", c.MySQLConfig.MaxOpenConns)
+		v.nonNegative("mysql.max_idle_conns", c.MySQLConfig.MaxIdleConns)
+		if c.MySQLConfig.MaxOpenConns > 0 && c.MySQLConfig.MaxIdleConns > c.MySQLConfig.MaxOpenConns {
+			v.addf("mysql.max_idle_conns", "不能大于 max_open_conns (%d)", c.MySQLConfig.MaxOpenConns)
+		}
+	}
+
+	// redis 暂时还没有接入，配置了 host 的时候才校验
+	if c.RedisConfig != nil && c.RedisConfig.Host != "" {
+		v.port("redis.port", c.RedisConfig.Port)
+		v.nonNegative("redis.db", c.RedisConfig.Db)
+	}
+
+	if c.RemoteConfig != nil && c.RemoteConfig.Provider != "" {
+		v.oneOf("remote.provider", c.RemoteConfig.Provider, []string{"http", "dir"})
+		v.required("remote.endpoint", c.RemoteConfig.Endpoint)
+		v.required("remote.key", c.RemoteConfig.Key)
+		v.oneOf("remote.format", c.RemoteConfig.Format, []string{"yaml", "json"})
+		if c.RemoteConfig.Interval <= 0 {
+			v.addf("remote.interval", "必须大于 0")
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
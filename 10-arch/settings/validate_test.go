@@ -0,0 +1,108 @@
+package settings
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validConfig() *AppConfig {
+	return &AppConfig{
+		Name: "web_app",
+		Mode: "dev",
+		Port: 8080,
+		LogConfig: &LogConfig{
+			Level:    "info",
+			Filename: "web_app.log",
+			Writer:   "rotate",
+		},
+		HTTPConfig: &HTTPConfig{},
+		MySQLConfig: &MySQLConfig{
+			Host:         "127.0.0.1",
+			Port:         3306,
+			User:         "root",
+			Dbname:       "web_app",
+			MaxOpenConns: 10,
+			MaxIdleConns: 5,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *AppConfig)
+		keys   []string // 出错的配置项，为空时应当校验通过
+	}{
+		{"valid", func(c *AppConfig) {}, nil},
+		{"missing name", func(c *AppConfig) { c.Name = " " }, []string{"name"}},
+		{"bad mode", func(c *AppConfig) { c.Mode = "staging" }, []string{"mode"}},
+		{"port too small", func(c *AppConfig) { c.Port = 0 }, []string{"port"}},
+		{"port too large", func(c *AppConfig) { c.Port = 65536 }, []string{"port"}},
+		{"bad log level", func(c *AppConfig) { c.LogConfig.Level = "verbose" }, []string{"log.level"}},
+		{"missing log section", func(c *AppConfig) { c.LogConfig = nil }, []string{"log"}},
+		{"negative max_size", func(c *AppConfig) { c.LogConfig.MaxSize = -1 }, []string{"log.max_size"}},
+		{"bad rotate", func(c *AppConfig) { c.LogConfig.Rotate = "weekly" }, []string{"log.rotate"}},
+		{"bad sinks", func(c *AppConfig) {
+			c.LogConfig.Sinks = []SinkConfig{
+				{Encoder: "json", Output: "stdout"},
+				{Encoder: "xml", Output: "syslog", Level: "verbose"},
+			}
+		}, []string{"log.sinks[1].encoder", "log.sinks[1].output", "log.sinks[1].level"}},
+		{"async", func(c *AppConfig) {
+			c.LogConfig.Async = AsyncConfig{Enabled: true, Policy: "drop-all"}
+		}, []string{"log.async.queue_size", "log.async.policy", "log.async.flush_interval"}},
+		{"async disabled", func(c *AppConfig) {
+			c.LogConfig.Async = AsyncConfig{Policy: "drop-all"}
+		}, nil},
+		{"bad webhook", func(c *AppConfig) {
+			c.LogConfig.Notify = NotifyConfig{Webhook: "ftp://example.com", Level: "error", Interval: time.Minute, Timeout: time.Second}
+		}, []string{"log.notify.webhook"}},
+		{"bad slow route", func(c *AppConfig) {
+			c.HTTPConfig.Slow.Routes = []SlowRoute{{Route: "/api/[", Threshold: -time.Second}}
+		}, []string{"http.slow.routes[0].route", "http.slow.routes[0].threshold"}},
+		{"capture", func(c *AppConfig) {
+			c.HTTPConfig.Capture = CaptureConfig{Routes: []string{"/api/*"}, ContentTypes: []string{"text/html"}}
+		}, []string{"http.capture.max_bytes", "http.capture.content_types[0]"}},
+		{"missing mysql", func(c *AppConfig) {
+			c.MySQLConfig.Host, c.MySQLConfig.User, c.MySQLConfig.Dbname = "", "", ""
+		}, []string{"mysql.host", "mysql.user", "mysql.dbname"}},
+		{"max_idle > max_open", func(c *AppConfig) { c.MySQLConfig.MaxIdleConns = 20 }, []string{"mysql.max_idle_conns"}},
+		{"unlimited max_open", func(c *AppConfig) {
+			c.MySQLConfig.MaxOpenConns, c.MySQLConfig.MaxIdleConns = 0, 20
+		}, nil},
+		{"redis without host", func(c *AppConfig) { c.RedisConfig = &RedisConfig{Port: -1} }, nil},
+		{"redis", func(c *AppConfig) { c.RedisConfig = &RedisConfig{Host: "127.0.0.1"} }, []string{"redis.port"}},
+		{"remote", func(c *AppConfig) {
+			c.RemoteConfig = &RemoteConfig{Provider: "etcd", Format: "yaml", Interval: time.Second}
+		}, []string{"remote.provider", "remote.endpoint", "remote.key"}},
+	}
+	for _, tt := range tests {
+		c := validConfig()
+		tt.modify(c)
+		var got []string
+		if err := validate(c, nil); err != nil {
+			for _, fe := range err.(ValidationError) {
+				got = append(got, fe.Key)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.keys) {
+			t.Errorf("%s: got errors on %v, want %v", tt.name, got, tt.keys)
+		}
+	}
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	err := validate(validConfig(), []string{"name", "mysql.host", "mysql.hots", "log.levle"})
+	ve, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("validate() = %v, want ValidationError", err)
+	}
+	want := ValidationError{
+		{Key: "log.levle", Msg: "未知的配置项"},
+		{Key: "mysql.hots", Msg: "未知的配置项"},
+	}
+	if !reflect.DeepEqual(ve, want) {
+		t.Errorf("validate() = %v, want %v", ve, want)
+	}
+}
@@ -0,0 +1,103 @@
+package settings
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// debounce 编辑器保存文件时往往会连续触发好几个事件，等文件稳定下来之后再重新加载
+const debounce = 100 * time.Millisecond
+
+// watcher 监听配置文件链中的所有文件
+// 监听的是文件所在的目录，这样文件被删除后重建（很多编辑器都是这样保存的）或者新建 config.local.yaml 都能感知到
+type watcher struct {
+	fw *fsnotify.Watcher
+
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string]bool
+	timer *time.Timer
+}
+
+// fileWatcher 由 reloadMu 保护
+var fileWatcher *watcher
+
+// watch 开始监听配置文件，任何一个文件发生变化都会重新加载整个配置
+func watch(files []string) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w := &watcher{fw: fw, dirs: make(map[string]bool)}
+	if err := w.set(files); err != nil {
+		_ = fw.Close()
+		return err
+	}
+	reloadMu.Lock()
+	fileWatcher = w
+	reloadMu.Unlock()
+	go w.run()
+	return nil
+}
+
+// set 更新需要监听的文件，mode 变化之后配置文件链也会跟着变化
+func (w *watcher) set(files []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = make(map[string]bool)
+	for _, f := range files {
+		f = filepath.Clean(f)
+		w.files[f] = true
+		dir := filepath.Dir(f)
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.fw.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = true
+	}
+	return nil
+}
+
+// close 停止监听，还没触发的重新加载也一起取消
+func (w *watcher) close() {
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	_ = w.fw.Close()
+}
+
+func (w *watcher) run() {
+	for {
+		select {
+		case e, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			name := filepath.Clean(e.Name)
+			w.mu.Lock()
+			if w.files[name] {
+				if w.timer != nil {
+					w.timer.Stop()
+				}
+				w.timer = time.AfterFunc(debounce, func() { reload(name) })
+			}
+			w.mu.Unlock()
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			zap.L().Error("watch config files failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals 收到这些信号时重新打开日志文件，配合 logrotate 使用（log.writer 为 reopen 时）
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
+
+func isReopenSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR1
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// reopenSignals Windows 上没有 SIGUSR1，不支持通过信号重新打开日志文件
+var reopenSignals []os.Signal
+
+func isReopenSignal(os.Signal) bool {
+	return false
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"os"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -10,7 +11,8 @@ import (
 var db *sqlx.DB
 
 func initDB() (err error) {
-	dsn := "root:asdvbn789@tcp(127.0.0.1:3306)/sql_test?charset=utf8mb4&parseTime=True"
+	// 密码从环境变量中读取，不要写在代码里
+	dsn := fmt.Sprintf("root:%s@tcp(127.0.0.1:3306)/sql_test?charset=utf8mb4&parseTime=True", os.Getenv("DB_PASS"))
 
 	// 如果用MustConnect, 那么连接不成功直接就panic了,不带Must那么就会返回一个错误，然后自己处理
 	db, err := sqlx.Connect("mysql", dsn)
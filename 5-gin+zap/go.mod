@@ -5,6 +5,9 @@ go 1.12
 require (
 	github.com/gin-gonic/gin v1.6.3
 	github.com/natefinch/lumberjack v2.0.0+incompatible
+	go-web/ginzap v0.0.0
 	go.uber.org/zap v1.16.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
+
+replace go-web/ginzap => ../ginzap
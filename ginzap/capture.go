@@ -0,0 +1,153 @@
+package ginzap
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Capture 在访问日志中记录请求体和响应体的配置
+type Capture struct {
+	MaxBytes     int      // 请求体和响应体各自最多记录多少字节，超过的部分不记录
+	ContentTypes []string // 只记录这些 Content-Type 的 body，例如 application/json
+	// Filter 记录之前处理 body，例如脱敏，truncated 表示超过了 MaxBytes 只保留了前面的部分
+	// 为 nil 时原样记录
+	Filter func(contentType string, body []byte, truncated bool) string
+}
+
+// WithBodyCapture 在访问日志中记录请求体和响应体，fn 在执行 handler 之前调用，返回 nil 时不记录
+// 请求体读取之后会放回去，handler 可以正常读取；响应体一边写给客户端一边记录，不影响流式响应
+func WithBodyCapture(fn func(c *gin.Context) *Capture) Option {
+	return func(o *options) {
+		o.capture = fn
+	}
+}
+
+// MatchRoute 判断请求是否匹配 pattern，pattern 可以是路由模板（例如 /users/:id）、实际的路径，或者 path.Match 的通配符
+func MatchRoute(pattern string, c *gin.Context) bool {
+	route, p := c.FullPath(), c.Request.URL.Path
+	if pattern == route || pattern == p {
+		return true
+	}
+	if ok, _ := path.Match(pattern, route); ok && route != "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+func (cp *Capture) allowed(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range cp.ContentTypes {
+		if mt == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *Capture) field(key, contentType string, body []byte, truncated bool) zap.Field {
+	if cp.Filter == nil {
+		return zap.ByteString(key, body)
+	}
+	return zap.String(key, cp.Filter(contentType, body, truncated))
+}
+
+// captureRequest 读取请求体的前 MaxBytes 个字节，再把读出来的内容放回去
+func (cp *Capture) captureRequest(c *gin.Context) []zap.Field {
+	r := c.Request
+	ct := r.Header.Get("Content-Type")
+	if r.Body == nil || r.Body == http.NoBody || !cp.allowed(ct) {
+		return nil
+	}
+	buf := make([]byte, cp.MaxBytes+1)
+	n, err := io.ReadFull(r.Body, buf)
+	buf = buf[:n]
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), &errReader{err}, r.Body), r.Body}
+	if n == 0 {
+		return nil
+	}
+	truncated := n > cp.MaxBytes
+	if truncated {
+		buf = buf[:cp.MaxBytes]
+	}
+	fields := []zap.Field{cp.field("request_body", ct, buf, truncated)}
+	if truncated {
+		fields = append(fields, zap.Bool("request_body_truncated", true))
+	}
+	return fields
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader 读取请求体时除了 EOF 之外的错误留给 handler
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	if r.err == nil || r.err == io.EOF || r.err == io.ErrUnexpectedEOF {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
+
+// bodyWriter 把写给客户端的内容同时记录下来，只记录前 max 个字节
+// 嵌入了 gin.ResponseWriter，Flush、CloseNotify、Hijack 等方法不受影响
+type bodyWriter struct {
+	gin.ResponseWriter
+	cp        *Capture
+	checked   bool // 第一次写入时按 Content-Type 判断是否记录
+	capture   bool
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *bodyWriter) record(p []byte) {
+	if !w.checked {
+		w.checked = true
+		w.capture = w.cp.allowed(w.Header().Get("Content-Type"))
+	}
+	if !w.capture || w.truncated {
+		return
+	}
+	if left := w.cp.MaxBytes - w.buf.Len(); len(p) > left {
+		p = p[:left]
+		w.truncated = true
+	}
+	w.buf.Write(p)
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.record(p[:n])
+	return n, err
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record([]byte(s[:n]))
+	return n, err
+}
+
+func (w *bodyWriter) fields() []zap.Field {
+	if !w.capture || w.buf.Len() == 0 {
+		return nil
+	}
+	fields := []zap.Field{w.cp.field("response_body", w.Header().Get("Content-Type"), w.buf.Bytes(), w.truncated)}
+	if w.truncated {
+		fields = append(fields, zap.Bool("response_body_truncated", true))
+	}
+	return fields
+}
@@ -0,0 +1,136 @@
+package ginzap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyCapture(t *testing.T) {
+	long := `{"name":"` + strings.Repeat("x", 64) + `"}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		respType    string
+		wantReq     interface{} // nil 表示不记录
+		wantResp    interface{}
+		truncated   bool
+	}{
+		{"json", "application/json", `{"id":1}`, "application/json; charset=utf-8", `{"id":1}`, `{"id":1}`, false},
+		{"form", "application/x-www-form-urlencoded", "a=1&b=2", "text/plain", "a=1&b=2", nil, false},
+		{"not allowed", "text/plain", "hello", "text/html", nil, nil, false},
+		{"bad content type", "application/json; ===", `{"id":1}`, "", nil, nil, false},
+		{"truncated", "application/json", long, "application/json", long[:32], long[:32], true},
+	}
+	for _, tt := range tests {
+		var read string
+		h := func(c *gin.Context) {
+			// handler 仍然能读到完整的请求体
+			b, _ := ioutil.ReadAll(c.Request.Body)
+			read = string(b)
+			c.Data(http.StatusOK, tt.respType, b)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		entries := serve(t, req, h, WithBodyCapture(func(c *gin.Context) *Capture {
+			return &Capture{MaxBytes: 32, ContentTypes: []string{"application/json", "application/x-www-form-urlencoded"}}
+		}))
+
+		if read != tt.body {
+			t.Errorf("%s: handler read %q, want %q", tt.name, read, tt.body)
+		}
+		fields := entries[0].ContextMap()
+		if got := fields["request_body"]; got != tt.wantReq {
+			t.Errorf("%s: request_body = %v, want %v", tt.name, got, tt.wantReq)
+		}
+		if got := fields["response_body"]; got != tt.wantResp {
+			t.Errorf("%s: response_body = %v, want %v", tt.name, got, tt.wantResp)
+		}
+		_, reqTruncated := fields["request_body_truncated"]
+		_, respTruncated := fields["response_body_truncated"]
+		if reqTruncated != tt.truncated || respTruncated != tt.truncated {
+			t.Errorf("%s: truncated = %v/%v, want %v", tt.name, reqTruncated, respTruncated, tt.truncated)
+		}
+	}
+}
+
+func TestBodyCaptureFilter(t *testing.T) {
+	type call struct {
+		contentType string
+		body        string
+		truncated   bool
+	}
+	var calls []call
+	cp := &Capture{
+		MaxBytes:     4,
+		ContentTypes: []string{"application/json"},
+		Filter: func(contentType string, body []byte, truncated bool) string {
+			calls = append(calls, call{contentType, string(body), truncated})
+			return "filtered"
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(`{"password":"p"}`))
+	req.Header.Set("Content-Type", "application/json")
+	entries := serve(t, req, func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) },
+		WithBodyCapture(func(c *gin.Context) *Capture { return cp }))
+
+	fields := entries[0].ContextMap()
+	if fields["request_body"] != "filtered" || fields["response_body"] != "filtered" {
+		t.Fatalf("Filter was not applied: %v", fields)
+	}
+	want := []call{
+		{"application/json", `{"pa`, true},
+		{"application/json; charset=utf-8", `{"ok`, true},
+	}
+	if len(calls) != 2 || calls[0] != want[0] || calls[1] != want[1] {
+		t.Fatalf("Filter calls = %+v, want %+v", calls, want)
+	}
+}
+
+func TestBodyCaptureStreaming(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	w := httptest.NewRecorder()
+	r := gin.New()
+	r.Use(Logger(WithBodyCapture(func(c *gin.Context) *Capture {
+		return &Capture{MaxBytes: 1024, ContentTypes: []string{"text/event-stream"}}
+	})))
+	flushed := false
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, "data: 1\n\n")
+		// 包装之后的 ResponseWriter 仍然支持 Flush
+		c.Writer.Flush()
+		flushed = w.Flushed
+	})
+	r.ServeHTTP(w, req)
+	if !flushed || w.Body.String() != "data: 1\n\n" {
+		t.Fatalf("flushed = %v, body = %q", flushed, w.Body.String())
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"/users/:id", true},
+		{"/users/42", true},
+		{"/users/*", true},
+		{"/orders/*", false},
+		{"/users", false},
+	}
+	for _, tt := range tests {
+		var got bool
+		r := gin.New()
+		r.GET("/users/:id", func(c *gin.Context) { got = MatchRoute(tt.pattern, c) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+		if got != tt.want {
+			t.Errorf("MatchRoute(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
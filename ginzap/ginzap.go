@@ -0,0 +1,311 @@
+// Package ginzap 用 zap 记录 gin 的访问日志和 panic，通过 Option 配置，不依赖具体服务的配置，可以在各个服务之间共用
+// 是一个单独的 module（go-web/ginzap），其他服务在 go.mod 中用 replace 指向这个目录
+//
+//	r.Use(ginzap.Logger(ginzap.WithLogger(lg), ginzap.WithSkipPaths("/health")), ginzap.Recovery(ginzap.WithLogger(lg)))
+package ginzap
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Extractor 从请求中取出需要额外记录的字段，例如用户 ID
+type Extractor func(c *gin.Context) []zap.Field
+
+// Option 配置 Logger 和 Recovery
+type Option func(*options)
+
+type options struct {
+	logger      func(c *gin.Context) *zap.Logger
+	skipPaths   map[string]bool
+	skipStatus  map[int]bool
+	utc         bool
+	timeFormat  string
+	extractors  []Extractor
+	route       bool
+	levels      map[int]zapcore.Level // 状态码的类别（2、3、4、5）对应的日志级别
+	query       func(string) string
+	dumpRequest func(*http.Request) []byte
+	stack       bool
+	capture     func(c *gin.Context) *Capture
+	onPanic     []PanicHandler
+}
+
+// PanicMessage Recovery 记录 panic 时日志的 msg
+const PanicMessage = "[Recovery from panic]"
+
+// PanicHandler Recovery 记录完 panic 之后调用，例如发送告警，stack 始终是 panic 的调用栈，不受 WithStack 影响
+type PanicHandler func(c *gin.Context, err interface{}, stack []byte)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		logger:     func(*gin.Context) *zap.Logger { return zap.L() },
+		skipPaths:  make(map[string]bool),
+		skipStatus: make(map[int]bool),
+		levels:     make(map[int]zapcore.Level),
+		query:      func(q string) string { return q },
+		dumpRequest: func(r *http.Request) []byte {
+			b, _ := httputil.DumpRequest(r, false)
+			return b
+		},
+		stack: true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.utc {
+		get := o.logger
+		o.logger = func(c *gin.Context) *zap.Logger {
+			return get(c).WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+				return utcCore{core}
+			}))
+		}
+	}
+	return o
+}
+
+// utcCore 把日志的时间换成 UTC 之后再交给 Core，编码出来的时间都是 UTC
+type utcCore struct {
+	zapcore.Core
+}
+
+func (c utcCore) With(fields []zapcore.Field) zapcore.Core {
+	return utcCore{c.Core.With(fields)}
+}
+
+func (c utcCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ent.Time = ent.Time.UTC()
+	return c.Core.Check(ent, ce)
+}
+
+func (c utcCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Time = ent.Time.UTC()
+	return c.Core.Write(ent, fields)
+}
+
+// WithLogger 使用指定的 logger，默认使用 zap.L()
+func WithLogger(lg *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = func(*gin.Context) *zap.Logger { return lg }
+	}
+}
+
+// WithLoggerFunc 每个请求通过 fn 取 logger，例如取带有请求 ID 的 logger
+func WithLoggerFunc(fn func(c *gin.Context) *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = fn
+	}
+}
+
+// WithSkipPaths 这些路径的请求不记录访问日志，例如健康检查
+func WithSkipPaths(paths ...string) Option {
+	return func(o *options) {
+		for _, p := range paths {
+			o.skipPaths[p] = true
+		}
+	}
+}
+
+// WithSkipStatus 返回这些状态码的请求不记录访问日志
+func WithSkipStatus(codes ...int) Option {
+	return func(o *options) {
+		for _, code := range codes {
+			o.skipStatus[code] = true
+		}
+	}
+}
+
+// WithUTC 访问日志和 panic 日志的时间使用 UTC，WithTimeFormat 的 start 字段也使用 UTC
+func WithUTC() Option {
+	return func(o *options) {
+		o.utc = true
+	}
+}
+
+// WithTimeFormat 记录请求开始时间的 start 字段，layout 为时间格式，默认不记录
+func WithTimeFormat(layout string) Option {
+	return func(o *options) {
+		o.timeFormat = layout
+	}
+}
+
+// WithFields 在访问日志中增加 fn 返回的字段，可以多次使用
+func WithFields(fn Extractor) Option {
+	return func(o *options) {
+		o.extractors = append(o.extractors, fn)
+	}
+}
+
+// WithRouteTemplate path 字段记录路由的模板（例如 /users/:id）而不是实际的路径，方便按接口统计
+// 没有匹配到路由的请求仍然记录实际的路径，日志的 msg 始终是实际的路径
+func WithRouteTemplate() Option {
+	return func(o *options) {
+		o.route = true
+	}
+}
+
+// WithStatusLevel 设置某一类状态码的日志级别，class 为状态码的第一位，例如 5 表示 5xx，默认都是 info
+func WithStatusLevel(class int, level zapcore.Level) Option {
+	return func(o *options) {
+		o.levels[class] = level
+	}
+}
+
+// WithQueryFilter 记录查询字符串之前用 fn 处理，例如对 token 参数脱敏
+func WithQueryFilter(fn func(rawQuery string) string) Option {
+	return func(o *options) {
+		o.query = fn
+	}
+}
+
+// WithRequestDump Recovery 记录请求内容时使用 fn，例如对 Authorization 请求头脱敏，默认为 httputil.DumpRequest
+func WithRequestDump(fn func(r *http.Request) []byte) Option {
+	return func(o *options) {
+		o.dumpRequest = fn
+	}
+}
+
+// WithStack Recovery 是否记录 panic 的调用栈，默认记录
+func WithStack(stack bool) Option {
+	return func(o *options) {
+		o.stack = stack
+	}
+}
+
+// WithPanicHandler Recovery 记录完 panic 之后调用 fn，可以多次使用，连接断开导致的 panic 不会调用
+func WithPanicHandler(fn PanicHandler) Option {
+	return func(o *options) {
+		o.onPanic = append(o.onPanic, fn)
+	}
+}
+
+// ContextValue 返回一个 Extractor，把 c.Get(key) 的值记录到 field 字段中，例如鉴权中间件保存的用户 ID
+func ContextValue(key, field string) Extractor {
+	return func(c *gin.Context) []zap.Field {
+		if v, ok := c.Get(key); ok {
+			return []zap.Field{zap.Any(field, v)}
+		}
+		return nil
+	}
+}
+
+// Logger 记录访问日志
+func Logger(opts ...Option) gin.HandlerFunc {
+	o := newOptions(opts)
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		query := c.Request.URL.RawQuery
+		var reqBody []zap.Field
+		var bw *bodyWriter
+		if o.capture != nil && !o.skipPaths[path] {
+			if cp := o.capture(c); cp != nil && cp.MaxBytes > 0 {
+				reqBody = cp.captureRequest(c)
+				bw = &bodyWriter{ResponseWriter: c.Writer, cp: cp}
+				c.Writer = bw
+			}
+		}
+		c.Next()
+
+		status := c.Writer.Status()
+		if o.skipPaths[path] || o.skipStatus[status] {
+			return
+		}
+		cost := time.Since(start)
+
+		pathField := path
+		if o.route && c.FullPath() != "" {
+			pathField = c.FullPath()
+		}
+		fields := []zap.Field{
+			zap.Int("status", status),
+			zap.String("method", c.Request.Method),
+			zap.String("path", pathField),
+			zap.String("query", o.query(query)),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user-agent", c.Request.UserAgent()),
+			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
+			zap.Duration("cost", cost),
+		}
+		if o.timeFormat != "" {
+			t := start
+			if o.utc {
+				t = t.UTC()
+			}
+			fields = append(fields, zap.String("start", t.Format(o.timeFormat)))
+		}
+		for _, fn := range o.extractors {
+			fields = append(fields, fn(c)...)
+		}
+		fields = append(fields, reqBody...)
+		if bw != nil {
+			fields = append(fields, bw.fields()...)
+		}
+
+		level, ok := o.levels[status/100]
+		if !ok {
+			level = zapcore.InfoLevel
+		}
+		if ce := o.logger(c).Check(level, path); ce != nil {
+			ce.Write(fields...)
+		}
+	}
+}
+
+// Recovery recover 掉 handler 中的 panic，用 zap 记录之后返回 500
+func Recovery(opts ...Option) gin.HandlerFunc {
+	o := newOptions(opts)
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				lg := o.logger(c)
+				// Check for a broken connection, as it is not really a
+				// condition that warrants a panic stack trace.
+				var brokenPipe bool
+				if ne, ok := err.(*net.OpError); ok {
+					if se, ok := ne.Err.(*os.SyscallError); ok {
+						if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
+							brokenPipe = true
+						}
+					}
+				}
+
+				httpRequest := o.dumpRequest(c.Request)
+				if brokenPipe {
+					lg.Error(c.Request.URL.Path,
+						zap.Any("error", err),
+						zap.String("request", string(httpRequest)),
+					)
+					// If the connection is dead, we can't write a status to it.
+					c.Error(err.(error)) // nolint: errcheck
+					c.Abort()
+					return
+				}
+
+				stack := debug.Stack()
+				fields := []zap.Field{
+					zap.Any("error", err),
+					zap.String("request", string(httpRequest)),
+				}
+				if o.stack {
+					fields = append(fields, zap.String("stack", string(stack)))
+				}
+				lg.Error(PanicMessage, fields...)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				for _, fn := range o.onPanic {
+					fn(c, err, stack)
+				}
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package ginzap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve 用 opts 创建 Logger 和 Recovery，处理一个请求之后返回记录的日志
+func serve(t *testing.T, req *http.Request, h gin.HandlerFunc, opts ...Option) []observer.LoggedEntry {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	opts = append([]Option{WithLogger(zap.New(core))}, opts...)
+	r := gin.New()
+	r.Use(Logger(opts...), Recovery(opts...))
+	r.Any("/users/:id", h)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return logs.All()
+}
+
+func TestWithUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*3600)
+	defer func() { time.Local = local }()
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	boom := func(c *gin.Context) { panic("boom") }
+	for _, h := range []gin.HandlerFunc{ok, boom} {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		entries := serve(t, req, h, WithUTC(), WithTimeFormat(time.RFC3339))
+		if len(entries) == 0 {
+			t.Fatal("no log entries")
+		}
+		for _, e := range entries {
+			if e.Time.Location() != time.UTC {
+				t.Errorf("%q: time %v is not UTC", e.Message, e.Time)
+			}
+			if start, ok := e.ContextMap()["start"].(string); ok && start[len(start)-1] != 'Z' {
+				t.Errorf("start = %q, want UTC", start)
+			}
+		}
+	}
+
+	entries := serve(t, httptest.NewRequest(http.MethodGet, "/users/1", nil), ok)
+	if loc := entries[0].Time.Location(); loc == time.UTC {
+		t.Errorf("without WithUTC the time should stay local, got %v", loc)
+	}
+}
+
+func TestLoggerRouteTemplateAndLevels(t *testing.T) {
+	fail := func(c *gin.Context) { c.Status(http.StatusBadGateway) }
+	req := httptest.NewRequest(http.MethodGet, "/users/42?token=abc", nil)
+	entries := serve(t, req, fail,
+		WithRouteTemplate(),
+		WithStatusLevel(5, zapcore.ErrorLevel),
+		WithQueryFilter(func(string) string { return "filtered" }),
+	)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Level != zapcore.ErrorLevel {
+		t.Errorf("level = %v, want error", e.Level)
+	}
+	fields := e.ContextMap()
+	if fields["path"] != "/users/:id" || fields["query"] != "filtered" || e.Message != "/users/42" {
+		t.Errorf("unexpected entry: msg=%q fields=%v", e.Message, fields)
+	}
+}
@@ -0,0 +1,11 @@
+module go-web/ginzap
+
+go 1.12
+
+require (
+	github.com/gin-gonic/gin v1.6.3
+	github.com/pkg/errors v0.9.1 // indirect
+	go.uber.org/atomic v1.4.0 // indirect
+	go.uber.org/multierr v1.1.0 // indirect
+	go.uber.org/zap v1.10.0
+)